@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// BatchWriteItem limit
+const maxBatchSize = 25
+
+// max time an item waits for a full batch
+const batchDelay = 2 * time.Second
+
+// attempts to write items left unprocessed by DynamoDB
+const batchRetries = 8
+
+// Collects items of one table and writes (or deletes) them with BatchWriteItem.
+// Batch is written when it is full, after batchDelay or on Flush
+type batchWriter struct {
+	db   *DataBase
+	size int
+
+	// delay before retry of unprocessed items
+	backoff func(attempt int) time.Duration
+
+	mutex   sync.Mutex
+	pending []*batchEntry
+	keys    map[string]bool
+	timer   *time.Timer
+
+	// batches being written
+	inflight sync.WaitGroup
+}
+
+type batchEntry struct {
+	key     string
+	request *dynamodb.WriteRequest
+	done    func(err error)
+}
+
+func newBatchWriter(db *DataBase, size int) *batchWriter {
+	if size > maxBatchSize {
+		size = maxBatchSize
+	}
+	return &batchWriter{db: db, size: size, backoff: batchBackoff, keys: make(map[string]bool)}
+}
+
+// must be called with mutex locked
+func (b *batchWriter) take() []*batchEntry {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	batch := b.pending
+	b.pending = nil
+	b.keys = make(map[string]bool)
+	if len(batch) > 0 {
+		b.inflight.Add(1)
+	}
+	return batch
+}
+
+func (b *batchWriter) add(ctx context.Context, entry *batchEntry) {
+	var batches [][]*batchEntry
+
+	b.mutex.Lock()
+	// one request can't contain the same key twice
+	if b.keys[entry.key] {
+		batches = append(batches, b.take())
+	}
+
+	b.pending = append(b.pending, entry)
+	b.keys[entry.key] = true
+
+	if len(b.pending) >= b.size {
+		batches = append(batches, b.take())
+	} else if len(b.pending) == 1 {
+		b.timer = time.AfterFunc(batchDelay, func() { b.flush(ctx, false) })
+	}
+	b.mutex.Unlock()
+
+	for _, batch := range batches {
+		b.write(ctx, batch)
+	}
+}
+
+// writes pending items, wait - also wait for batches being written by other routines
+func (b *batchWriter) flush(ctx context.Context, wait bool) {
+	b.mutex.Lock()
+	batch := b.take()
+	b.mutex.Unlock()
+
+	b.write(ctx, batch)
+	if wait {
+		b.inflight.Wait()
+	}
+}
+
+// calls done of every entry
+func (b *batchWriter) write(ctx context.Context, batch []*batchEntry) {
+	if len(batch) == 0 {
+		return
+	}
+	defer b.inflight.Done()
+
+	table := b.db.schema.Name
+	requests := make([]*dynamodb.WriteRequest, 0, len(batch))
+	for _, entry := range batch {
+		requests = append(requests, entry.request)
+	}
+
+	var err error
+	rejected := false
+	for attempt := 0; len(requests) > 0; attempt++ {
+		if attempt > 0 {
+			if attempt > batchRetries {
+				if err == nil {
+					err = fmt.Errorf("Item is not written to '%s' after %d attempts", table, batchRetries+1)
+				}
+				break
+			}
+
+			if err = sleepContext(ctx, b.backoff(attempt)); err != nil {
+				break
+			}
+		}
+
+		var output *dynamodb.BatchWriteItemOutput
+		output, err = b.db.svc.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*dynamodb.WriteRequest{table: requests},
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			if request.IsErrorRetryable(err) || request.IsErrorThrottle(err) {
+				continue
+			}
+			// one invalid item rejects the whole request
+			rejected = true
+			break
+		}
+		requests = output.UnprocessedItems[table]
+	}
+
+	// items left in requests are failed
+	failed := make(map[string]bool)
+	for _, request := range requests {
+		if request.PutRequest != nil {
+			failed[b.db.itemKeyString(request.PutRequest.Item)] = true
+		}
+		if request.DeleteRequest != nil {
+			failed[b.db.itemKeyString(request.DeleteRequest.Key)] = true
+		}
+	}
+
+	for _, entry := range batch {
+		switch {
+		case !failed[entry.key]:
+			entry.done(nil)
+		case rejected:
+			entry.done(b.writeOne(ctx, entry.request))
+		default:
+			entry.done(err)
+		}
+	}
+}
+
+// item of rejected batch is written alone, so it gets its own error
+func (b *batchWriter) writeOne(ctx context.Context, request *dynamodb.WriteRequest) error {
+	table := aws.String(b.db.schema.Name)
+	if request.PutRequest != nil {
+		_, err := b.db.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{TableName: table, Item: request.PutRequest.Item})
+		return err
+	}
+	_, err := b.db.svc.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{TableName: table, Key: request.DeleteRequest.Key})
+	return err
+}
+
+// 100ms, 200ms, 400ms ... up to 10s with jitter
+func batchBackoff(attempt int) time.Duration {
+	d := 100 * time.Millisecond << uint(attempt-1)
+	if d <= 0 || d > 10*time.Second {
+		d = 10 * time.Second
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// identifies item in a batch
+func (db *DataBase) itemKeyString(item map[string]*dynamodb.AttributeValue) string {
+	value := func(name string) string {
+		if av, ok := item[name]; ok {
+			return aws.StringValue(av.S) + aws.StringValue(av.N)
+		}
+		return ""
+	}
+
+	key := value(db.schema.PrimaryKey)
+	if db.schema.HasSortKey() {
+		key += "\x00" + value(db.schema.SortKey)
+	}
+	return key
+}
+
+// BatchStore implementation
+
+// Item is written with the next batch. Items of other articles with the same key
+// must not be overwritten, so without DOI primary key items are written one by one
+func (db *DataBase) PutAsync(ctx context.Context, item ArticleMetaInfo, done func(err error)) {
+	if db.batch == nil || (db.schema.PrimaryKey != "DOI" && item.DOI != "") {
+		done(db.Put(ctx, item))
+		return
+	}
+
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		done(err)
+		return
+	}
+	db.prepareItem(av)
+
+	db.batch.add(ctx, &batchEntry{
+		key:     db.itemKeyString(av),
+		request: &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: av}},
+		done:    done,
+	})
+}
+
+// Item is deleted with the next batch
+func (db *DataBase) DeleteAsync(ctx context.Context, key ItemKey, done func(err error)) {
+	if db.batch == nil {
+		done(db.Delete(ctx, key))
+		return
+	}
+
+	attributes := db.keyAttributes(key)
+	db.batch.add(ctx, &batchEntry{
+		key:     db.itemKeyString(attributes),
+		request: &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: attributes}},
+		done:    done,
+	})
+}
+
+// writes pending items and waits for batches in progress
+func (db *DataBase) Flush(ctx context.Context) {
+	if db.batch != nil {
+		db.batch.flush(ctx, true)
+	}
+}
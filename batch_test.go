@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// DynamoDB endpoint answering BatchWriteItem. unprocessed returns keys left unprocessed
+// by the call, requests holds keys of every call
+type fakeBatchTable struct {
+	mutex       sync.Mutex
+	requests    [][]string
+	unprocessed func(call int, key string) bool
+}
+
+func (f *fakeBatchTable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var input dynamodb.BatchWriteItemInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mutex.Lock()
+	call := len(f.requests)
+	var keys []string
+	var left []map[string]interface{}
+	for _, request := range input.RequestItems["Articles"] {
+		key, kind := "", "PutRequest"
+		if request.PutRequest != nil {
+			key = aws.StringValue(request.PutRequest.Item["DOI"].S)
+		} else {
+			key, kind = aws.StringValue(request.DeleteRequest.Key["DOI"].S), "DeleteRequest"
+		}
+		keys = append(keys, key)
+
+		if f.unprocessed != nil && f.unprocessed(call, key) {
+			field := "Item"
+			if kind == "DeleteRequest" {
+				field = "Key"
+			}
+			left = append(left, map[string]interface{}{kind: map[string]interface{}{field: map[string]interface{}{"DOI": map[string]string{"S": key}}}})
+		}
+	}
+	f.requests = append(f.requests, keys)
+	f.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	output := map[string]interface{}{}
+	if len(left) > 0 {
+		output["UnprocessedItems"] = map[string]interface{}{"Articles": left}
+	}
+	json.NewEncoder(w).Encode(output)
+}
+
+func newFakeBatchDataBase(t *testing.T, table *fakeBatchTable, size int) *DataBase {
+	server := httptest.NewServer(table)
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &DataBase{svc: dynamodb.New(sess), schema: TableSchema{Name: "Articles", PrimaryKey: "DOI", PrimaryKeyType: "S"}}
+	db.batch = newBatchWriter(db, size)
+	db.batch.backoff = func(attempt int) time.Duration { return time.Millisecond }
+	return db
+}
+
+func TestBatchWriterSplitsBatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		keys     []string
+		requests [][]string
+	}{
+		{"flush", 25, []string{"a", "b", "c"}, [][]string{{"a", "b", "c"}}},
+		{"full batches", 2, []string{"a", "b", "c", "d", "e"}, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}},
+		{"duplicate key", 25, []string{"a", "b", "a", "c"}, [][]string{{"a", "b"}, {"a", "c"}}},
+		{"duplicate key of full batch", 3, []string{"a", "a", "b", "c", "d"}, [][]string{{"a"}, {"a", "b", "c"}, {"d"}}},
+		{"nothing to write", 25, nil, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			table := &fakeBatchTable{}
+			db := newFakeBatchDataBase(t, table, test.size)
+
+			var errs []error
+			for _, key := range test.keys {
+				db.PutAsync(context.Background(), ArticleMetaInfo{DOI: key, Title: "Title " + key}, func(err error) {
+					errs = append(errs, err)
+				})
+			}
+			db.Flush(context.Background())
+
+			if !reflect.DeepEqual(table.requests, test.requests) {
+				t.Errorf("requests = %v, want %v", table.requests, test.requests)
+			}
+			if len(errs) != len(test.keys) {
+				t.Fatalf("%d callbacks, want %d", len(errs), len(test.keys))
+			}
+			for i, err := range errs {
+				if err != nil {
+					t.Errorf("item %d: %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchWriterUnprocessedItems(t *testing.T) {
+	tests := []struct {
+		name        string
+		unprocessed func(call int, key string) bool
+		calls       int
+		failed      []string
+	}{
+		{
+			name:        "all processed",
+			unprocessed: func(call int, key string) bool { return false },
+			calls:       1,
+		},
+		{
+			name:        "retried once",
+			unprocessed: func(call int, key string) bool { return call == 0 && (key == "b" || key == "d") },
+			calls:       2,
+		},
+		{
+			name:        "retried until processed",
+			unprocessed: func(call int, key string) bool { return call < 3 && key == "c" },
+			calls:       4,
+		},
+		{
+			name:        "never processed",
+			unprocessed: func(call int, key string) bool { return key == "b" },
+			calls:       batchRetries + 1,
+			failed:      []string{"b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			table := &fakeBatchTable{unprocessed: test.unprocessed}
+			db := newFakeBatchDataBase(t, table, 25)
+
+			// puts and deletes are mapped back to their callbacks by key
+			results := make(map[string]error)
+			for _, key := range []string{"a", "b", "c"} {
+				key := key
+				db.PutAsync(context.Background(), ArticleMetaInfo{DOI: key}, func(err error) { results[key] = err })
+			}
+			db.DeleteAsync(context.Background(), ItemKey{Primary: "d"}, func(err error) { results["d"] = err })
+			db.Flush(context.Background())
+
+			if len(table.requests) != test.calls {
+				t.Errorf("%d BatchWriteItem calls, want %d: %v", len(table.requests), test.calls, table.requests)
+			}
+
+			failed := make(map[string]bool)
+			for _, key := range test.failed {
+				failed[key] = true
+			}
+			for _, key := range []string{"a", "b", "c", "d"} {
+				err, called := results[key]
+				switch {
+				case !called:
+					t.Errorf("%s: callback isn't called", key)
+				case failed[key] && err == nil:
+					t.Errorf("%s: error expected", key)
+				case !failed[key] && err != nil:
+					t.Errorf("%s: %v", key, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{5, 1600 * time.Millisecond},
+		{8, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.attempt), func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				if d := batchBackoff(test.attempt); d < test.max/2 || d > test.max {
+					t.Fatalf("batchBackoff(%d) = %v, want %v-%v", test.attempt, d, test.max/2, test.max)
+				}
+			}
+		})
+	}
+}
+
+func TestItemKeyString(t *testing.T) {
+	item := map[string]*dynamodb.AttributeValue{
+		"DOI":    {S: aws.String("10.1007/1")},
+		"Volume": {N: aws.String("3")},
+	}
+
+	tests := []struct {
+		schema TableSchema
+		key    string
+	}{
+		{TableSchema{PrimaryKey: "DOI", PrimaryKeyType: "S"}, "10.1007/1"},
+		{TableSchema{PrimaryKey: "DOI", PrimaryKeyType: "S", SortKey: "Volume", SortKeyType: "N"}, "10.1007/1\x003"},
+		{TableSchema{PrimaryKey: "Volume", PrimaryKeyType: "N", SortKey: "Title", SortKeyType: "S"}, "3\x00"},
+	}
+
+	for _, test := range tests {
+		db := &DataBase{schema: test.schema}
+		if key := db.itemKeyString(item); key != test.key {
+			t.Errorf("%+v: key = %q, want %q", test.schema, key, test.key)
+		}
+	}
+}
+
+func TestBatchWriterRejectedBatch(t *testing.T) {
+	fake := newFakeDynamoDB()
+	fake.addTable(testSchema, ArticleMetaInfo{DOI: "d"})
+	db := newFakeDataBase(t, fake, "Articles")
+
+	results := make(map[string]error)
+	for _, item := range []ArticleMetaInfo{{DOI: "a"}, {DOI: "b", Title: "invalid"}, {DOI: "c"}} {
+		key := item.DOI
+		db.PutAsync(context.Background(), item, func(err error) { results[key] = err })
+	}
+	db.DeleteAsync(context.Background(), ItemKey{Primary: "d"}, func(err error) { results["d"] = err })
+	db.Flush(context.Background())
+
+	if calls := fake.called("BatchWriteItem"); calls != 1 {
+		t.Errorf("%d BatchWriteItem calls, want 1", calls)
+	}
+	if puts, deletes := fake.called("PutItem"), fake.called("DeleteItem"); puts != 3 || deletes != 1 {
+		t.Errorf("%d PutItem and %d DeleteItem calls, want 3 and 1", puts, deletes)
+	}
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		err, called := results[key]
+		switch {
+		case !called:
+			t.Errorf("%s: callback isn't called", key)
+		case key == "b" && err == nil:
+			t.Errorf("%s: error expected", key)
+		case key != "b" && err != nil:
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+
+	var stored []string
+	for _, item := range fake.items("Articles") {
+		stored = append(stored, item.DOI)
+	}
+	if !reflect.DeepEqual(stored, []string{"a", "c"}) {
+		t.Errorf("stored items = %v, want [a c]", stored)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// storage backend for downloaded PDF files
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context) ([]string, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	// replaces existing blob
+	Move(ctx context.Context, from, to string) error
+}
+
+// Local filesystem store. Every blob is a file inside root directory
+type DirBlobStore struct {
+	root string
+}
+
+func NewDirBlobStore(root string) *DirBlobStore {
+	return &DirBlobStore{root: root}
+}
+
+// keys are flat file names, don't let them escape root
+func (d *DirBlobStore) path(key string) string {
+	return filepath.Join(d.root, filepath.Base(filepath.Clean("/"+key)))
+}
+
+func (d *DirBlobStore) Put(ctx context.Context, key string, body io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(d.root, 0755); err != nil {
+		return err
+	}
+
+	// write to temporary file first so partially written PDFs never appear under the real name
+	tmpFile, err := ioutil.TempFile(d.root, ".upload-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tmpFile, body)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), d.path(key))
+}
+
+func (d *DirBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(d.path(key))
+}
+
+func (d *DirBlobStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(d.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (d *DirBlobStore) List(ctx context.Context) (keys []string, err error) {
+	files, err := ioutil.ReadDir(d.root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		// skip unfinished uploads
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".upload-") {
+			continue
+		}
+		keys = append(keys, file.Name())
+	}
+	return
+}
+
+func (d *DirBlobStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := os.Stat(d.path(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (d *DirBlobStore) Move(ctx context.Context, from, to string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return os.Rename(d.path(from), d.path(to))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// body failing after some bytes, like a broken download
+type failingReader struct {
+	body io.Reader
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if err == io.EOF {
+		return n, r.err
+	}
+	return n, err
+}
+
+func readBlob(t *testing.T, blobs BlobStore, key string) string {
+	body, err := blobs.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestDirBlobStore(t *testing.T) {
+	ctx := context.Background()
+	blobs := NewDirBlobStore(filepath.Join(newTestDir(t), "pdf"))
+
+	// directory is created by the first Put
+	if keys, err := blobs.List(ctx); err != nil || keys != nil {
+		t.Fatalf("List of missing directory = %v, %v", keys, err)
+	}
+
+	for key, body := range map[string]string{"a.pdf": "%PDF a", "b.pdf": "%PDF b", "b.xml": "<article/>"} {
+		if err := blobs.Put(ctx, key, strings.NewReader(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if content := readBlob(t, blobs, "a.pdf"); content != "%PDF a" {
+		t.Errorf("a.pdf = %q", content)
+	}
+
+	if exists, err := blobs.Exists(ctx, "b.pdf"); err != nil || !exists {
+		t.Errorf("Exists(b.pdf) = %v, %v", exists, err)
+	}
+	if exists, err := blobs.Exists(ctx, "c.pdf"); err != nil || exists {
+		t.Errorf("Exists(c.pdf) = %v, %v", exists, err)
+	}
+
+	// moved blob replaces the existing one
+	if err := blobs.Move(ctx, "b.pdf", "a.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if content := readBlob(t, blobs, "a.pdf"); content != "%PDF b" {
+		t.Errorf("a.pdf after move = %q", content)
+	}
+
+	if err := blobs.Delete(ctx, "b.xml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := blobs.Delete(ctx, "b.xml"); err != nil {
+		t.Errorf("deleting missing blob: %v", err)
+	}
+
+	keys, err := blobs.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a.pdf"}) {
+		t.Errorf("keys = %v, want [a.pdf]", keys)
+	}
+}
+
+func TestDirBlobStoreKeysStayInRoot(t *testing.T) {
+	dir := newTestDir(t)
+	blobs := NewDirBlobStore(filepath.Join(dir, "pdf"))
+
+	for _, key := range []string{"../escaped.pdf", "/etc/escaped.xml", "sub/dir/escaped.txt"} {
+		if err := blobs.Put(context.Background(), key, strings.NewReader("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := blobs.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"escaped.pdf", "escaped.txt", "escaped.xml"}) {
+		t.Errorf("keys = %v", keys)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "escaped.pdf")); !os.IsNotExist(err) {
+		t.Error("blob is written outside the root")
+	}
+}
+
+func TestDirBlobStoreFailedPut(t *testing.T) {
+	ctx := context.Background()
+	dir := newTestDir(t)
+	blobs := NewDirBlobStore(dir)
+
+	if err := blobs.Put(ctx, "a.pdf", strings.NewReader("%PDF old")); err != nil {
+		t.Fatal(err)
+	}
+
+	broken := errors.New("connection reset")
+	if err := blobs.Put(ctx, "a.pdf", &failingReader{strings.NewReader("%PDF new, cut off"), broken}); err != broken {
+		t.Errorf("error = %v, want %v", err, broken)
+	}
+
+	// the old file is kept, nothing is left behind
+	if content := readBlob(t, blobs, "a.pdf"); content != "%PDF old" {
+		t.Errorf("a.pdf = %q, want the old content", content)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("%d files in the directory, want 1", len(files))
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := blobs.Put(cancelled, "b.pdf", strings.NewReader("%PDF")); err != context.Canceled {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+}
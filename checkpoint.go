@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Journal of harvesting progress. Every line is one of:
+//
+//	query <search queries>
+//	page <query name>:<start offset>   - all records of the page are stored
+//	record <table>|<DOI>               - record is stored
+//
+// Lines are appended as soon as something is done, so the journal survives crashes and Ctrl-C
+type Checkpoint struct {
+	mutex   sync.Mutex
+	path    string
+	file    *os.File
+	pages   map[string]bool
+	records map[string]bool
+
+	// number of not yet stored records for every fetched page
+	pending map[string]int
+}
+
+// Opens journal at path. If resume is false, previous journal is discarded
+func OpenCheckpoint(path, query string, resume bool) (*Checkpoint, error) {
+	c := &Checkpoint{
+		path:    path,
+		pages:   make(map[string]bool),
+		records: make(map[string]bool),
+		pending: make(map[string]int),
+	}
+
+	var complete int64
+	if resume {
+		var err error
+		if complete, err = c.load(query); err != nil {
+			return nil, err
+		}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !resume {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	c.file = file
+
+	// line cut off by a crash is dropped, otherwise new lines would be glued to it
+	if resume {
+		if err = file.Truncate(complete); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	if !resume {
+		if err = c.write("query", query); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Returns length of complete lines. Last line without newline may be cut off by a crash
+// ("page q:11" -> "page q:1"), so it is ignored
+func (c *Checkpoint) load(query string) (complete int64, err error) {
+	file, err := os.Open(c.path)
+	if os.IsNotExist(err) {
+		return 0, fmt.Errorf("Checkpoint file '%s' not found, nothing to resume", c.path)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return complete, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		complete += int64(len(line))
+
+		parts := strings.SplitN(strings.TrimSuffix(line, "\n"), " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		switch parts[0] {
+		case "query":
+			if parts[1] != query {
+				return 0, fmt.Errorf("Checkpoint '%s' belongs to another query (%s)", c.path, parts[1])
+			}
+		case "page":
+			c.pages[parts[1]] = true
+		case "record":
+			c.records[parts[1]] = true
+		}
+	}
+}
+
+func (c *Checkpoint) write(kind, value string) error {
+	if c.file == nil {
+		return fmt.Errorf("Checkpoint '%s' is closed", c.path)
+	}
+	_, err := fmt.Fprintf(c.file, "%s %s\n", kind, value)
+	return err
+}
+
+func (c *Checkpoint) PageDone(page string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.pages[page]
+}
+
+func (c *Checkpoint) RecordDone(key string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.records[key]
+}
+
+func (c *Checkpoint) Pages() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.pages)
+}
+
+func (c *Checkpoint) Records() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.records)
+}
+
+// must be called before records of the page are sent to storing
+func (c *Checkpoint) PageFetched(page string, recordCount int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if recordCount == 0 {
+		c.pages[page] = true
+		return c.write("page", page)
+	}
+	c.pending[page] += recordCount
+	return nil
+}
+
+// marks record as stored. Page is marked when its last record is stored.
+// Empty key only counts the record for its page (e.g. duplicates)
+func (c *Checkpoint) RecordStored(key string, page string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if key != "" && !c.records[key] {
+		c.records[key] = true
+		if err := c.write("record", key); err != nil {
+			return err
+		}
+	}
+
+	c.pending[page]--
+	if c.pending[page] == 0 {
+		delete(c.pending, page)
+		c.pages[page] = true
+		return c.write("page", page)
+	}
+	return nil
+}
+
+func (c *Checkpoint) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.file == nil {
+		return nil
+	}
+	c.file.Sync()
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+// removes journal after a run without errors
+func (c *Checkpoint) Remove() error {
+	if err := c.Close(); err != nil {
+		return err
+	}
+	return os.Remove(c.path)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testQuery = "query=decompilation&p=10&api=pam"
+
+// temporary directory removed after the test
+func newTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "springerMetaInfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func newTestCheckpoint(t *testing.T) (*Checkpoint, string) {
+	path := filepath.Join(newTestDir(t), "test.checkpoint")
+	checkpoint, err := OpenCheckpoint(path, testQuery, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { checkpoint.Close() })
+	return checkpoint, path
+}
+
+func TestCheckpointPageDoneAfterLastRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		records int
+		stored  []string // "" - duplicate, only counted
+		done    bool
+	}{
+		{"empty page", 0, nil, true},
+		{"all stored", 3, []string{"T|1", "T|2", "T|3"}, true},
+		{"one left", 3, []string{"T|1", "T|2"}, false},
+		{"duplicates are counted", 3, []string{"T|1", "", ""}, true},
+		{"nothing stored", 2, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkpoint, _ := newTestCheckpoint(t)
+
+			if err := checkpoint.PageFetched("query:1", test.records); err != nil {
+				t.Fatal(err)
+			}
+			for i, key := range test.stored {
+				if checkpoint.PageDone("query:1") {
+					t.Fatalf("page is done after %d of %d records", i, test.records)
+				}
+				if err := checkpoint.RecordStored(key, "query:1"); err != nil {
+					t.Fatal(err)
+				}
+				if key != "" && !checkpoint.RecordDone(key) {
+					t.Errorf("record %s isn't done", key)
+				}
+			}
+
+			if done := checkpoint.PageDone("query:1"); done != test.done {
+				t.Errorf("page done = %v, want %v", done, test.done)
+			}
+		})
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	checkpoint, path := newTestCheckpoint(t)
+	checkpoint.PageFetched("query:1", 2)
+	checkpoint.RecordStored("T|1", "query:1")
+	checkpoint.RecordStored("T|2", "query:1")
+	checkpoint.PageFetched("query:11", 2)
+	checkpoint.RecordStored("T|3", "query:11")
+	if err := checkpoint.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := OpenCheckpoint(path, testQuery, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Close()
+
+	if resumed.Pages() != 1 || resumed.Records() != 3 {
+		t.Errorf("resumed %d pages and %d records, want 1 and 3", resumed.Pages(), resumed.Records())
+	}
+	if !resumed.PageDone("query:1") || resumed.PageDone("query:11") {
+		t.Error("only page query:1 should be done")
+	}
+	if !resumed.RecordDone("T|3") || resumed.RecordDone("T|4") {
+		t.Error("only stored records should be done")
+	}
+
+	if _, err := OpenCheckpoint(path, "query=obfuscation&p=10&api=pam", true); err == nil {
+		t.Error("checkpoint of another query is resumed")
+	}
+	if _, err := OpenCheckpoint(path+".missing", testQuery, true); err == nil {
+		t.Error("missing checkpoint is resumed")
+	}
+}
+
+func TestCheckpointCutOffLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		journal string
+		pages   []string
+		records []string
+	}{
+		{
+			name:    "complete",
+			journal: "query " + testQuery + "\npage query:11\nrecord T|1\n",
+			pages:   []string{"query:11"},
+			records: []string{"T|1"},
+		},
+		{
+			name:    "page number cut off",
+			journal: "query " + testQuery + "\npage query:11\npage query:1",
+			pages:   []string{"query:11"},
+		},
+		{
+			name:    "record key cut off",
+			journal: "query " + testQuery + "\nrecord T|10.1007/1\nrecord T|10.10",
+			records: []string{"T|10.1007/1"},
+		},
+		{
+			name:    "kind cut off",
+			journal: "query " + testQuery + "\nrecord T|1\npa",
+			records: []string{"T|1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, path := newTestCheckpoint(t)
+			if err := ioutil.WriteFile(path, []byte(test.journal), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			checkpoint, err := OpenCheckpoint(path, testQuery, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if checkpoint.Pages() != len(test.pages) || checkpoint.Records() != len(test.records) {
+				t.Errorf("loaded %d pages and %d records, want %v and %v", checkpoint.Pages(), checkpoint.Records(), test.pages, test.records)
+			}
+			for _, page := range test.pages {
+				if !checkpoint.PageDone(page) {
+					t.Errorf("page %s isn't done", page)
+				}
+			}
+			for _, record := range test.records {
+				if !checkpoint.RecordDone(record) {
+					t.Errorf("record %s isn't done", record)
+				}
+			}
+
+			// lines written after resume are not glued to the cut off one
+			checkpoint.PageFetched("query:21", 0)
+			checkpoint.Close()
+
+			reloaded, err := OpenCheckpoint(path, testQuery, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reloaded.Close()
+			if !reloaded.PageDone("query:21") || reloaded.Pages() != len(test.pages)+1 {
+				t.Errorf("page written after resume is lost, pages %d", reloaded.Pages())
+			}
+		})
+	}
+}
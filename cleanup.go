@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const purgeUsage = `  Deletes DynamoDB table and/or S3 bucket with all its objects. Example:
+  springerMetaInfo purge -tablename="SampleTable" -bucketname="myuniquebucketname3287" -dryrun`
+
+func runPurgeCommand(args []string) {
+	flags := newCommandFlags("purge", purgeUsage)
+
+	tablename := flags.String("tablename", "", "Table name to delete. Example: -tablename=\"Music\"")
+	bucketname := flags.String("bucketname", "", "S3 bucket name to empty and delete. Example -bucketname=\"myuniquebucketname3287\"")
+	dryRun := flags.Bool("dryrun", false, "Only show what would be deleted. Example: -dryrun")
+	yes := flags.Bool("yes", false, "Don't ask for confirmation. Example: -yes")
+	credentials := addAWSFlags(flags)
+	flags.Parse(args)
+
+	if *tablename == "" && *bucketname == "" {
+		fmt.Fprintln(os.Stderr, "-tablename or -bucketname is required")
+		flags.Usage()
+		os.Exit(2)
+	}
+	ctx := interruptContext()
+
+	// without -yes every deletion is confirmed
+	approve := func(question string) bool {
+		return *yes || confirm(question)
+	}
+
+	if *tablename != "" {
+		database, err := credentials.database()
+		check(err)
+		check(purgeTable(ctx, database, *tablename, *dryRun, approve))
+	}
+
+	if *bucketname != "" {
+		manager, err := credentials.bucketManager()
+		check(err)
+		check(purgeBucket(ctx, manager, *bucketname, *dryRun, approve))
+	}
+
+	if *dryRun {
+		fmt.Println("Dry run, nothing is deleted")
+	}
+}
+
+// Deletes the table unless it's a dry run or deletion isn't approved
+func purgeTable(ctx context.Context, database *DataBase, tablename string, dryRun bool, approve func(question string) bool) error {
+	output, err := database.svc.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tablename)})
+	if err != nil {
+		return err
+	}
+
+	// item count is updated by DynamoDB about every 6 hours
+	fmt.Printf("Table '%s' (about %d items) will be deleted\n", tablename, aws.Int64Value(output.Table.ItemCount))
+	if dryRun || !approve("Delete table '"+tablename+"'?") {
+		return nil
+	}
+
+	fmt.Println("Deleting table -", tablename)
+	if err = database.DeleteTable(ctx, tablename); err != nil {
+		return err
+	}
+	fmt.Println("Table is deleted")
+	return nil
+}
+
+// Empties and deletes the bucket unless it's a dry run or deletion isn't approved, dry run lists the objects
+func purgeBucket(ctx context.Context, manager *S3Manager, bucketname string, dryRun bool, approve func(question string) bool) error {
+	var count int
+	var size int64
+	objects := manager.Objects(ctx, bucketname, ListOptions{})
+	for objects.Next() {
+		if dryRun {
+			fmt.Println(objects.Object().Key)
+		}
+		count++
+		size += objects.Object().Size
+	}
+	if err := objects.Err(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Bucket '%s' and its %d object(-s) (%d bytes) will be deleted\n", bucketname, count, size)
+	if dryRun || !approve("Delete bucket '"+bucketname+"'?") {
+		return nil
+	}
+
+	// bucket must be empty before deletion
+	deleted, err := manager.EmptyBucket(ctx, bucketname, func(deleted int) {
+		fmt.Printf("Deleted: %d object(-s)\n", deleted)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Deleted %d object(-s) before error\n", deleted)
+		return err
+	}
+
+	fmt.Println("Deleting bucket -", bucketname)
+	if err = manager.DeleteBucket(ctx, bucketname); err != nil {
+		return err
+	}
+	fmt.Println("Bucket is deleted")
+	return nil
+}
+
+const deleteUsage = `  Deletes items matching the query from DynamoDB table, with -bucketname their files are deleted too.
+  Identical files are stored once, files other items still refer to are kept. Items of other tables harvested
+  into the same bucket are checked only if the tables are given with -sharedtable. Items are selected the same way as by query command. Example:
+  springerMetaInfo delete -tablename="SampleTable" -year=2010 -publisher=Springer -bucketname="myuniquebucketname3287" -sharedtable="OtherTable" -dryrun`
+
+func runDeleteCommand(args []string) {
+	flags := newCommandFlags("delete", deleteUsage)
+
+	tablename := flags.String("tablename", "", "Table name to delete items from. Example: -tablename=\"Music\"")
+	tableQuery := addTableQueryFlags(flags)
+	bucketname := flags.String("bucketname", "", "S3 bucket with files (PDF, full text) of the items to delete too. Example -bucketname=\"myuniquebucketname3287\"")
+	var sharedTables listFlag
+	flags.Var(&sharedTables, "sharedtable", "Other table with files in the bucket, files its items refer to are kept. Can be repeated. Example: -sharedtable=\"OtherTable\"")
+	dryRun := flags.Bool("dryrun", false, "Only list items that would be deleted. Example: -dryrun")
+	yes := flags.Bool("yes", false, "Don't ask for confirmation. Example: -yes")
+	credentials := addAWSFlags(flags)
+	flags.Parse(args)
+
+	requireFlag(flags, "tablename", *tablename)
+	query := tableQuery()
+	ctx := interruptContext()
+
+	database, err := credentials.database()
+	check(err)
+	check(database.OpenTable(ctx, *tablename))
+
+	// items are listed before anything is deleted
+	var items []ArticleMetaInfo
+	listing := newTableWriter()
+	_, err = database.Find(ctx, *tablename, query, func(item ArticleMetaInfo) error {
+		items = append(items, item)
+		return listing.Write(item)
+	})
+	listing.Close()
+	check(err)
+
+	fmt.Printf("%d item(-s) of '%s' will be deleted\n", len(items), *tablename)
+	if *dryRun {
+		fmt.Println("Dry run, nothing is deleted")
+		return
+	}
+	if len(items) == 0 || !(*yes || confirm(fmt.Sprintf("Delete %d item(-s)?", len(items)))) {
+		return
+	}
+
+	var manager *S3Manager
+	tables := []*DataBase{database}
+	if *bucketname != "" {
+		manager, err = credentials.bucketManager()
+		check(err)
+
+		shared, err := openTables(ctx, database, sharedTables)
+		check(err)
+		tables = append(tables, shared...)
+	}
+
+	deleted, deletedFiles, errs := deleteItemsAndFiles(ctx, tables, manager, *bucketname, items)
+	for _, err := range errs.Errors() {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	fmt.Println("Items deleted -", deleted)
+	if manager != nil {
+		fmt.Println("Files deleted -", deletedFiles)
+	}
+
+	if len(errs.Errors()) > 0 {
+		os.Exit(1)
+	}
+}
+
+// Deletes items from the first table. With manager their files are deleted too,
+// except files some item of the tables (the first one and tables sharing the bucket) still refers to
+func deleteItemsAndFiles(ctx context.Context, tables []*DataBase, manager *S3Manager, bucketname string, items []ArticleMetaInfo) (deleted, deletedFiles int, errs *errorList) {
+	deleted, files, errs := tables[0].deleteItems(ctx, items)
+	if manager == nil || len(files) == 0 {
+		return
+	}
+
+	files, err := unreferencedFiles(ctx, tables, files)
+	if err != nil {
+		errs.add(err)
+		return
+	}
+
+	deletedFiles, err = manager.DeleteKeys(ctx, bucketname, files)
+	errs.add(err)
+	return
+}
+
+// Deletes items in batches, returns number of deleted items and files of deleted items
+func (db *DataBase) deleteItems(ctx context.Context, items []ArticleMetaInfo) (deleted int, files []string, errs *errorList) {
+	errs = &errorList{}
+	var mutex sync.Mutex
+
+	for _, item := range items {
+		key, err := keyOf(db.schema, item)
+		if err != nil {
+			errs.add(err)
+			continue
+		}
+
+		item := item
+		db.DeleteAsync(ctx, key, func(err error) {
+			if err != nil {
+				errs.add(fmt.Errorf("%s: %v", item.DOI, err))
+				return
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			deleted++
+			for _, file := range []string{item.FileName, item.JATSFileName} {
+				if file != "" {
+					files = append(files, file)
+				}
+			}
+		})
+	}
+	db.Flush(ctx)
+	return
+}
+
+// Identical files are stored once and may be shared by several items (of several tables),
+// files some item of the tables still refers to are removed from the list
+func unreferencedFiles(ctx context.Context, tables []*DataBase, files []string) ([]string, error) {
+	unreferenced := make(map[string]bool, len(files))
+	for _, file := range files {
+		unreferenced[file] = true
+	}
+
+	for _, table := range tables {
+		_, err := table.Find(ctx, table.schema.Name, TableQuery{}, func(item ArticleMetaInfo) error {
+			for _, file := range itemFiles(item) {
+				delete(unreferenced, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var result []string
+	for _, file := range files {
+		if unreferenced[file] {
+			result = append(result, file)
+			delete(unreferenced, file)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testSchema = TableSchema{Name: "Articles", PrimaryKey: "DOI", PrimaryKeyType: "S"}
+
+func TestDeleteItemsAndFilesSharedTables(t *testing.T) {
+	tests := []struct {
+		name         string
+		sharedTables bool
+		deletedFiles int
+		keys         []string // left in the bucket
+	}{
+		{"file of other table is kept", true, 2, []string{"kept.pdf", "other.pdf", "shared.pdf"}},
+		{"other table isn't given", false, 3, []string{"kept.pdf", "other.pdf"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeDynamoDB()
+			fake.addTable(testSchema,
+				ArticleMetaInfo{DOI: "10.1/1", FileName: "shared.pdf"},
+				ArticleMetaInfo{DOI: "10.1/2", FileName: "own.pdf", JATSFileName: "own.xml"},
+				ArticleMetaInfo{DOI: "10.1/3", FileName: "kept.pdf"},
+				ArticleMetaInfo{DOI: "10.1/4", FileName: "kept.pdf"},
+			)
+			other := testSchema
+			other.Name = "Other"
+			fake.addTable(other, ArticleMetaInfo{DOI: "10.1/1", FileName: "shared.pdf"})
+
+			s3 := newFakeS3()
+			for _, key := range []string{"shared.pdf", "own.pdf", "own.xml", "kept.pdf", "other.pdf"} {
+				s3.addObject("bucket", key, "%PDF", time.Now())
+			}
+
+			tables := []*DataBase{newFakeDataBase(t, fake, "Articles")}
+			if test.sharedTables {
+				tables = append(tables, newFakeDataBase(t, fake, "Other"))
+			}
+
+			items := []ArticleMetaInfo{
+				{DOI: "10.1/1", FileName: "shared.pdf"},
+				{DOI: "10.1/2", FileName: "own.pdf", JATSFileName: "own.xml"},
+				{DOI: "10.1/4", FileName: "kept.pdf"},
+			}
+			deleted, deletedFiles, errs := deleteItemsAndFiles(context.Background(), tables, newFakeS3Manager(t, s3, ""), "bucket", items)
+			if len(errs.Errors()) > 0 {
+				t.Fatal(errs.Errors())
+			}
+
+			if deleted != 3 || deletedFiles != test.deletedFiles {
+				t.Errorf("deleted %d items and %d files, want 3 and %d", deleted, deletedFiles, test.deletedFiles)
+			}
+			if keys := s3.keys("bucket"); !reflect.DeepEqual(keys, test.keys) {
+				t.Errorf("bucket keys = %v, want %v", keys, test.keys)
+			}
+			if items := fake.items("Articles"); len(items) != 1 || items[0].DOI != "10.1/3" {
+				t.Errorf("items left = %+v, want 10.1/3", items)
+			}
+			if items := fake.items("Other"); len(items) != 1 {
+				t.Errorf("items of other table = %+v", items)
+			}
+		})
+	}
+}
+
+func TestPurgeTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		dryRun   bool
+		approved bool
+		deleted  bool
+	}{
+		{"deleted", false, true, true},
+		{"dry run", true, true, false},
+		{"not confirmed", false, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeDynamoDB()
+			fake.addTable(testSchema, ArticleMetaInfo{DOI: "10.1/1"})
+			other := testSchema
+			other.Name = "Other"
+			fake.addTable(other, ArticleMetaInfo{DOI: "10.1/1"})
+
+			approve := func(string) bool { return test.approved }
+			if err := purgeTable(context.Background(), newFakeDataBase(t, fake, ""), "Articles", test.dryRun, approve); err != nil {
+				t.Fatal(err)
+			}
+
+			if deleted := fake.called("DeleteTable") > 0; deleted != test.deleted {
+				t.Errorf("table deleted = %v, want %v", deleted, test.deleted)
+			}
+			if items := fake.items("Other"); len(items) != 1 {
+				t.Errorf("items of other table = %+v", items)
+			}
+		})
+	}
+
+	if err := purgeTable(context.Background(), newFakeDataBase(t, newFakeDynamoDB(), ""), "Missing", false, func(string) bool { return true }); err == nil {
+		t.Error("missing table: error expected")
+	}
+}
+
+func TestPurgeBucket(t *testing.T) {
+	tests := []struct {
+		name        string
+		dryRun      bool
+		approved    bool
+		undeletable string
+		keys        []string // left, nil - bucket is deleted
+	}{
+		{"deleted", false, true, "", nil},
+		{"dry run", true, true, "", []string{"a.pdf", "b.pdf", "c.xml"}},
+		{"not confirmed", false, false, "", []string{"a.pdf", "b.pdf", "c.xml"}},
+		{"undeletable object", false, true, "b.pdf", []string{"b.pdf"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s3 := newFakeS3()
+			s3.pageSize = 2
+			for _, key := range []string{"a.pdf", "b.pdf", "c.xml"} {
+				s3.addObject("bucket", key, "%PDF", time.Now())
+			}
+			s3.addObject("other", "a.pdf", "%PDF", time.Now())
+			if test.undeletable != "" {
+				s3.undeletable[test.undeletable] = true
+			}
+
+			approve := func(string) bool { return test.approved }
+			err := purgeBucket(context.Background(), newFakeS3Manager(t, s3, ""), "bucket", test.dryRun, approve)
+			if test.undeletable != "" && err == nil {
+				t.Error("error expected")
+			}
+			if test.undeletable == "" && err != nil {
+				t.Fatal(err)
+			}
+
+			if keys := s3.keys("bucket"); !reflect.DeepEqual(keys, test.keys) {
+				t.Errorf("bucket keys = %v, want %v", keys, test.keys)
+			}
+			if keys := s3.keys("other"); len(keys) != 1 {
+				t.Errorf("keys of other bucket = %v", keys)
+			}
+		})
+	}
+}
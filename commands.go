@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// Subcommands working with stored metadata, without subcommand records are harvested
+var commands = map[string]func(args []string){
+	"query":     runQueryCommand,
+	"purge":     runPurgeCommand,
+	"delete":    runDeleteCommand,
+	"reconcile": runReconcileCommand,
+}
+
+// runs subcommand if it is the first argument
+func runCommand() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		return false
+	}
+	command(os.Args[2:])
+	return true
+}
+
+// flags of subcommand, usage is printed with -h
+func newCommandFlags(name, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of %s %s:\n%s\n", os.Args[0], name, usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// AWS credentials, configuration of the computer is used if they are missing
+type awsFlags struct {
+	accessKey *string
+	secretKey *string
+	region    *string
+}
+
+func addAWSFlags(flags *flag.FlagSet) awsFlags {
+	return awsFlags{
+		accessKey: flags.String("accesskey", "", "Amazon DynamoDB Access Key ID"),
+		secretKey: flags.String("secretkey", "", "Amazon DynamoDB Secret Access Key ID"),
+		region:    flags.String("region", "", "Amazon DynamoDB Region"),
+	}
+}
+
+func (f awsFlags) auto() bool {
+	return *f.accessKey == "" && *f.secretKey == "" && *f.region == ""
+}
+
+func (f awsFlags) database() (*DataBase, error) {
+	database := &DataBase{}
+	if f.auto() {
+		return database, database.InitAuto()
+	}
+	return database, database.Init(*f.accessKey, *f.secretKey, *f.region)
+}
+
+func (f awsFlags) bucketManager() (*S3Manager, error) {
+	manager := &S3Manager{}
+	if f.auto() {
+		return manager, manager.InitAuto()
+	}
+	return manager, manager.Init(*f.accessKey, *f.secretKey, *f.region)
+}
+
+// existing tables sharing the connection of database
+func openTables(ctx context.Context, database *DataBase, tablenames []string) ([]*DataBase, error) {
+	var tables []*DataBase
+	for _, tablename := range tablenames {
+		table := &DataBase{svc: database.svc}
+		if err := table.OpenTable(ctx, tablename); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// asks user, only "y" and "yes" confirm
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	fmt.Println("Cancelled")
+	return false
+}
+
+// cancelled by Ctrl-C or SIGTERM
+func interruptContext() context.Context {
+	shutdown := NewShutdown()
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupts
+		shutdown.Abort()
+	}()
+	return shutdown.Context()
+}
+
+// required string flag
+func requireFlag(flags *flag.FlagSet, name, value string) {
+	if value == "" {
+		fmt.Fprintf(os.Stderr, "-%s is required\n", name)
+		flags.Usage()
+		os.Exit(2)
+	}
+}
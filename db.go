@@ -1,258 +1,400 @@
-package main
-
-import (
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"fmt"
-	"errors"
-)
-
-// DynamoDB wrapper
-type DataBase struct {
-	svc	*dynamodb.DynamoDB
-}
-
-func (db *DataBase) Init(accessKeyID, secretAccessKey, region string) error {
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String(region),
-		Credentials: credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
-	})
-	if err != nil {
-		return err
-	}
-
-	// check if credentials have been found
-	_, err = sess.Config.Credentials.Get()
-	if err != nil {
-		return err
-	}
-
-	db.svc = dynamodb.New(sess)
-	return nil
-}
-
-func (db *DataBase) InitAuto() error {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-
-	// check if creadentials have been found
-	_, err := sess.Config.Credentials.Get()
-	if err != nil {
-		return err
-	}
-
-	db.svc = dynamodb.New(sess)
-	return nil
-}
-
-func (db *DataBase) ListTables() (tableNames []string, err error) {
-	input := &dynamodb.ListTablesInput{}
-
-	for {
-		// Get the list of tables
-		result, err := db.svc.ListTables(input)
-		if err != nil {
-			if aerr, ok := err.(awserr.Error); ok {
-				switch aerr.Code() {
-				case dynamodb.ErrCodeInternalServerError:
-					return nil, errors.New(fmt.Sprint(dynamodb.ErrCodeInternalServerError, aerr.Error()))
-				default:
-					return nil, errors.New(aerr.Error())
-				}
-			} else {
-				return nil, err
-			}
-		}
-
-		for _, n := range result.TableNames {
-			tableNames = append(tableNames, *n)
-		}
-
-		input.ExclusiveStartTableName = result.LastEvaluatedTableName
-		if result.LastEvaluatedTableName == nil {
-			break
-		}
-	}
-	return
-}
-
-func (db *DataBase) waitUntilTableBecomeActive(tablename string) error {
-	input := &dynamodb.DescribeTableInput{
-		TableName : aws.String(tablename),
-	}
-
-	for {
-		output, err := db.svc.DescribeTable(input)
-		if err != nil {
-			if aerr, ok := err.(awserr.Error); ok {
-				switch aerr.Code() {
-				case dynamodb.ErrCodeResourceNotFoundException:
-					return errors.New(fmt.Sprint(dynamodb.ErrCodeResourceNotFoundException, aerr.Error()))
-				case dynamodb.ErrCodeInternalServerError:
-					return errors.New(fmt.Sprint(dynamodb.ErrCodeInternalServerError, aerr.Error()))
-				default:
-					return errors.New(aerr.Error())
-				}
-			} else {
-				return err
-			}
-		}
-
-		if *output.Table.TableStatus == "ACTIVE" {
-			break
-		} 
-	}
-	return nil
-}
-
-func (db *DataBase) CreateTableIfNotExists(tablename, primaryKey, primaryKeyType, sortKey, sortKeyType string) error {
-	tables, err := db.ListTables()
-	if err != nil {
-		return err
-	}
-
-	// find tablename match
-	for _, t := range tables {
-
-		// if matches just return, do nothing
-		if t == tablename {
-			return nil
-		}
-	}
-
-	// else create one
-	if sortKey == "" && sortKeyType == "" {
-		err = db.CreateTable(tablename, primaryKey, primaryKeyType)
-	} else {
-		err = db.CreateTableWithSort(tablename, primaryKey, primaryKeyType, sortKey, sortKeyType)
-	}
-
-	return err
-}
-
-func (db *DataBase) CreateTableWithSort(tablename, primaryKey, primaryAttributeType, sortKey, sortKeyType string) error {
-	if primaryAttributeType != "N" && primaryAttributeType != "S" {
-		return errors.New("Incorrect primary key type. Should be 'N' (Number) or 'S' (String)")
-	}
-	if sortKeyType != "N" && sortKeyType != "S" {
-		return errors.New("Incorrect sort key tpe. Should be 'N' (Number) or 'S' (String)")
-	}
-
-	input := &dynamodb.CreateTableInput{
-		AttributeDefinitions: []*dynamodb.AttributeDefinition{
-			{
-				AttributeName: aws.String(primaryKey),
-				AttributeType: aws.String(primaryAttributeType),
-			},
-			{
-				AttributeName: aws.String(sortKey),
-				AttributeType: aws.String(sortKeyType),
-			},
-		},
-		KeySchema: []*dynamodb.KeySchemaElement{
-			{
-				AttributeName: aws.String(primaryKey),
-				KeyType:       aws.String("HASH"),
-			},
-			{
-				AttributeName:	aws.String(sortKey),
-				KeyType:		aws.String("RANGE"),
-			},
-		},
-		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-			ReadCapacityUnits:  aws.Int64(10),
-			WriteCapacityUnits: aws.Int64(10),
-		},
-		TableName: aws.String(tablename),
-	}
-
-	if _, err := db.svc.CreateTable(input); err != nil {
-		return err
-	}
-
-	return db.waitUntilTableBecomeActive(tablename)
-}
-
-func (db *DataBase) CreateTable(tablename, primaryKey, primaryAttributeType string) error {
-	if primaryAttributeType != "N" && primaryAttributeType != "S" {
-		return errors.New("Incorrect primary key type. Should be 'N' (Number) or 'S' (String)")
-	}
-
-	input := &dynamodb.CreateTableInput{
-		AttributeDefinitions: []*dynamodb.AttributeDefinition{
-			{
-				AttributeName: aws.String(primaryKey),
-				AttributeType: aws.String(primaryAttributeType),
-			},
-		},
-		KeySchema: []*dynamodb.KeySchemaElement{
-			{
-				AttributeName: aws.String(primaryKey),
-				KeyType:       aws.String("HASH"),
-			},
-		},
-		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-			ReadCapacityUnits:  aws.Int64(10),
-			WriteCapacityUnits: aws.Int64(10),
-		},
-		TableName: aws.String(tablename),
-	}
-
-	if _, err := db.svc.CreateTable(input); err != nil {
-		return err
-	}
-
-	return db.waitUntilTableBecomeActive(tablename)
-}
-
-func (db *DataBase) DeleteTable(tablename string) error {
-	input := &dynamodb.DeleteTableInput {
-		TableName: aws.String(tablename),
-	}
-	
-	if _, err := db.svc.DeleteTable(input); err != nil {
-		return err
-	}
-	return nil
-}
-
-func (db *DataBase) DeleteItem(tablename, primaryKeyName, primaryAttributeType, primaryKeyValue string) error {
-	if primaryAttributeType != "N" && primaryAttributeType != "S" {
-		return errors.New("Incorrect primary key type. Should be 'N' (Number) or 'S' (String)")
-	}
-
-	var attributeValue map[string]*dynamodb.AttributeValue
-	if primaryAttributeType == "N" {
-		attributeValue = map[string]*dynamodb.AttributeValue{ primaryKeyName : { N: aws.String(primaryKeyValue) } }
-	} else {
-		attributeValue = map[string]*dynamodb.AttributeValue{ primaryKeyName : { S: aws.String(primaryKeyValue) } }
-	}
-
-	input := &dynamodb.DeleteItemInput{
-		Key: attributeValue,
-		TableName: aws.String(tablename),
-	}
-
-	_, err := db.svc.DeleteItem(input)
-
-	return err
-}
-
-func (db *DataBase) PutItem(tablename string, item interface{}) error {
-	av, err := dynamodbattribute.MarshalMap(item)
-	if err != nil {
-		return err
-	}
-	input := &dynamodb.PutItemInput {
-		Item : av,
-		TableName : aws.String(tablename),
-	}
-
-	_, err = db.svc.PutItem(input)
-	return err
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"fmt"
+	"errors"
+)
+
+// DynamoDB wrapper
+type DataBase struct {
+	svc	*dynamodb.DynamoDB
+	scaling	*applicationautoscaling.ApplicationAutoScaling
+	schema	TableSchema
+
+	// settings of created tables
+	options	TableOptions
+
+	// items per BatchWriteItem request, 0 or 1 - every item is written with PutItem
+	batchSize	int
+	batch		*batchWriter
+}
+
+func (db *DataBase) Init(accessKeyID, secretAccessKey, region string) error {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(region),
+		Credentials: credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
+	})
+	if err != nil {
+		return err
+	}
+
+	// check if credentials have been found
+	_, err = sess.Config.Credentials.Get()
+	if err != nil {
+		return err
+	}
+
+	db.svc = dynamodb.New(sess)
+	db.scaling = applicationautoscaling.New(sess)
+	return nil
+}
+
+func (db *DataBase) InitAuto() error {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	// check if creadentials have been found
+	_, err := sess.Config.Credentials.Get()
+	if err != nil {
+		return err
+	}
+
+	db.svc = dynamodb.New(sess)
+	db.scaling = applicationautoscaling.New(sess)
+	return nil
+}
+
+func (db *DataBase) ListTables(ctx context.Context) (tableNames []string, err error) {
+	input := &dynamodb.ListTablesInput{}
+
+	for {
+		// Get the list of tables
+		result, err := db.svc.ListTablesWithContext(ctx, input)
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				switch aerr.Code() {
+				case dynamodb.ErrCodeInternalServerError:
+					return nil, errors.New(fmt.Sprint(dynamodb.ErrCodeInternalServerError, aerr.Error()))
+				default:
+					return nil, errors.New(aerr.Error())
+				}
+			} else {
+				return nil, err
+			}
+		}
+
+		for _, n := range result.TableNames {
+			tableNames = append(tableNames, *n)
+		}
+
+		input.ExclusiveStartTableName = result.LastEvaluatedTableName
+		if result.LastEvaluatedTableName == nil {
+			break
+		}
+	}
+	return
+}
+
+// polls table status until it is ACTIVE
+func (db *DataBase) waitUntilTableBecomeActive(ctx context.Context, tablename string) error {
+	input := &dynamodb.DescribeTableInput{
+		TableName : aws.String(tablename),
+	}
+
+	err := db.svc.WaitUntilTableExistsWithContext(ctx, input)
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case dynamodb.ErrCodeResourceNotFoundException:
+			return errors.New(fmt.Sprint(dynamodb.ErrCodeResourceNotFoundException, aerr.Error()))
+		case dynamodb.ErrCodeInternalServerError:
+			return errors.New(fmt.Sprint(dynamodb.ErrCodeInternalServerError, aerr.Error()))
+		}
+	}
+	return err
+}
+
+func (db *DataBase) CreateTableIfNotExists(ctx context.Context, tablename, primaryKey, primaryKeyType, sortKey, sortKeyType string) error {
+	tables, err := db.ListTables(ctx)
+	if err != nil {
+		return err
+	}
+
+	// find tablename match
+	for _, t := range tables {
+
+		// if matches check that items fit into it
+		if t == tablename {
+			return db.checkTable(ctx, TableSchema{
+				Name:           tablename,
+				PrimaryKey:     primaryKey,
+				PrimaryKeyType: primaryKeyType,
+				SortKey:        sortKey,
+				SortKeyType:    sortKeyType,
+				Indexes:        db.schema.Indexes,
+			})
+		}
+	}
+
+	// else create one
+	if sortKey == "" && sortKeyType == "" {
+		err = db.CreateTable(ctx, tablename, primaryKey, primaryKeyType)
+	} else {
+		err = db.CreateTableWithSort(ctx, tablename, primaryKey, primaryKeyType, sortKey, sortKeyType)
+	}
+
+	return err
+}
+
+func (db *DataBase) CreateTableWithSort(ctx context.Context, tablename, primaryKey, primaryAttributeType, sortKey, sortKeyType string) error {
+	if primaryAttributeType != "N" && primaryAttributeType != "S" {
+		return errors.New("Incorrect primary key type. Should be 'N' (Number) or 'S' (String)")
+	}
+	if sortKeyType != "N" && sortKeyType != "S" {
+		return errors.New("Incorrect sort key tpe. Should be 'N' (Number) or 'S' (String)")
+	}
+
+	input := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String(primaryKey),
+				AttributeType: aws.String(primaryAttributeType),
+			},
+			{
+				AttributeName: aws.String(sortKey),
+				AttributeType: aws.String(sortKeyType),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String(primaryKey),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName:	aws.String(sortKey),
+				KeyType:		aws.String("RANGE"),
+			},
+		},
+		TableName: aws.String(tablename),
+	}
+	db.options.apply(input)
+	db.applyIndexes(input)
+
+	if _, err := db.svc.CreateTableWithContext(ctx, input); err != nil {
+		return err
+	}
+
+	if err := db.waitUntilTableBecomeActive(ctx, tablename); err != nil {
+		return err
+	}
+	return db.configureTable(ctx, tablename)
+}
+
+func (db *DataBase) CreateTable(ctx context.Context, tablename, primaryKey, primaryAttributeType string) error {
+	if primaryAttributeType != "N" && primaryAttributeType != "S" {
+		return errors.New("Incorrect primary key type. Should be 'N' (Number) or 'S' (String)")
+	}
+
+	input := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String(primaryKey),
+				AttributeType: aws.String(primaryAttributeType),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String(primaryKey),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		TableName: aws.String(tablename),
+	}
+	db.options.apply(input)
+	db.applyIndexes(input)
+
+	if _, err := db.svc.CreateTableWithContext(ctx, input); err != nil {
+		return err
+	}
+
+	if err := db.waitUntilTableBecomeActive(ctx, tablename); err != nil {
+		return err
+	}
+	return db.configureTable(ctx, tablename)
+}
+
+func (db *DataBase) DeleteTable(ctx context.Context, tablename string) error {
+	input := &dynamodb.DeleteTableInput {
+		TableName: aws.String(tablename),
+	}
+	
+	if _, err := db.svc.DeleteTableWithContext(ctx, input); err != nil {
+		return err
+	}
+
+	// wait until the table is deleted
+	return db.svc.WaitUntilTableNotExistsWithContext(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(tablename),
+	})
+}
+
+func (db *DataBase) DeleteItem(ctx context.Context, tablename, primaryKeyName, primaryAttributeType, primaryKeyValue string) error {
+	if primaryAttributeType != "N" && primaryAttributeType != "S" {
+		return errors.New("Incorrect primary key type. Should be 'N' (Number) or 'S' (String)")
+	}
+
+	var attributeValue map[string]*dynamodb.AttributeValue
+	if primaryAttributeType == "N" {
+		attributeValue = map[string]*dynamodb.AttributeValue{ primaryKeyName : { N: aws.String(primaryKeyValue) } }
+	} else {
+		attributeValue = map[string]*dynamodb.AttributeValue{ primaryKeyName : { S: aws.String(primaryKeyValue) } }
+	}
+
+	input := &dynamodb.DeleteItemInput{
+		Key: attributeValue,
+		TableName: aws.String(tablename),
+	}
+
+	_, err := db.svc.DeleteItemWithContext(ctx, input)
+
+	return err
+}
+
+func (db *DataBase) PutItem(ctx context.Context, tablename string, item interface{}) error {
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.PutItemInput {
+		Item : av,
+		TableName : aws.String(tablename),
+	}
+
+	_, err = db.svc.PutItemWithContext(ctx, input)
+	return err
+}
+
+// MetadataStore implementation
+
+func (db *DataBase) EnsureSchema(ctx context.Context, schema TableSchema) error {
+	db.schema = schema
+	if db.batchSize > 1 {
+		db.batch = newBatchWriter(db, db.batchSize)
+	}
+	return db.CreateTableIfNotExists(ctx, schema.Name, schema.PrimaryKey, schema.PrimaryKeyType, schema.SortKey, schema.SortKeyType)
+}
+
+func (db *DataBase) keyAttributes(key ItemKey) map[string]*dynamodb.AttributeValue {
+	attributeValue := func(attributeType, value string) *dynamodb.AttributeValue {
+		if attributeType == "N" {
+			return &dynamodb.AttributeValue{ N: aws.String(value) }
+		}
+		return &dynamodb.AttributeValue{ S: aws.String(value) }
+	}
+
+	attributes := map[string]*dynamodb.AttributeValue{
+		db.schema.PrimaryKey : attributeValue(db.schema.PrimaryKeyType, key.Primary),
+	}
+	if db.schema.HasSortKey() {
+		attributes[db.schema.SortKey] = attributeValue(db.schema.SortKeyType, key.Sort)
+	}
+	return attributes
+}
+
+// sets expiration and removes attributes rejected by indexes
+func (db *DataBase) prepareItem(item map[string]*dynamodb.AttributeValue) {
+	db.setExpiration(item)
+	db.removeEmptyIndexKeys(item)
+}
+
+// Inserts new item or updates item of the same article (DOI).
+// If the key isn't DOI, items of other articles with the same key are not overwritten
+func (db *DataBase) Put(ctx context.Context, item ArticleMetaInfo) error {
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return err
+	}
+	db.prepareItem(av)
+
+	if db.schema.PrimaryKey == "DOI" || item.DOI == "" {
+		_, err = db.svc.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			Item: av,
+			TableName: aws.String(db.schema.Name),
+		})
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item: av,
+		TableName: aws.String(db.schema.Name),
+		ConditionExpression: aws.String("attribute_not_exists(#pk) OR #doi = :doi OR attribute_not_exists(#doi)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#pk" : aws.String(db.schema.PrimaryKey),
+			"#doi" : aws.String("DOI"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":doi" : { S: aws.String(item.DOI) },
+		},
+	}
+
+	_, err = db.svc.PutItemWithContext(ctx, input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		key, keyErr := keyOf(db.schema, item)
+		if keyErr != nil {
+			return err
+		}
+
+		existingDOI := "?"
+		if existing, getErr := db.Get(ctx, key); getErr == nil {
+			existingDOI = existing.DOI
+		}
+		return &KeyConflictError{Key: key, ExistingDOI: existingDOI, DOI: item.DOI}
+	}
+	return err
+}
+
+func (db *DataBase) Get(ctx context.Context, key ItemKey) (*ArticleMetaInfo, error) {
+	output, err := db.svc.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		Key: db.keyAttributes(key),
+		TableName: aws.String(db.schema.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if output.Item == nil {
+		return nil, ErrItemNotFound
+	}
+
+	var item ArticleMetaInfo
+	if err = dynamodbattribute.UnmarshalMap(output.Item, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (db *DataBase) Delete(ctx context.Context, key ItemKey) error {
+	_, err := db.svc.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		Key: db.keyAttributes(key),
+		TableName: aws.String(db.schema.Name),
+	})
+	return err
+}
+
+func (db *DataBase) List(ctx context.Context) (items []ArticleMetaInfo, err error) {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(db.schema.Name),
+	}
+
+	var unmarshalErr error
+	err = db.svc.ScanPagesWithContext(ctx, input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		var pageItems []ArticleMetaInfo
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageItems); unmarshalErr != nil {
+			return false
+		}
+		items = append(items, pageItems...)
+		return true
+	})
+	if err == nil {
+		err = unmarshalErr
+	}
+	return
 }
\ No newline at end of file
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDataBasePutConditional(t *testing.T) {
+	titleKey := TableSchema{Name: "Articles", PrimaryKey: "Title", PrimaryKeyType: "S"}
+
+	tests := []struct {
+		name     string
+		item     ArticleMetaInfo
+		conflict bool
+		doi      string // of item with key "Title" afterwards
+	}{
+		{"the same article is updated", ArticleMetaInfo{DOI: "10.1/1", Title: "Title", Publisher: "Springer"}, false, "10.1/1"},
+		{"other article isn't overwritten", ArticleMetaInfo{DOI: "10.1/2", Title: "Title"}, true, "10.1/1"},
+		{"new key", ArticleMetaInfo{DOI: "10.1/2", Title: "Other"}, false, "10.1/1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeDynamoDB()
+			fake.addTable(titleKey, ArticleMetaInfo{DOI: "10.1/1", Title: "Title"})
+			db := newFakeDataBase(t, fake, "Articles")
+
+			err := db.Put(context.Background(), test.item)
+			var conflict *KeyConflictError
+			switch {
+			case test.conflict && !errors.As(err, &conflict):
+				t.Fatalf("error = %v, want KeyConflictError", err)
+			case test.conflict && (conflict.ExistingDOI != "10.1/1" || conflict.DOI != test.item.DOI):
+				t.Errorf("conflict = %+v", conflict)
+			case !test.conflict && err != nil:
+				t.Fatal(err)
+			}
+
+			stored, err := db.Get(context.Background(), ItemKey{Primary: "Title"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.DOI != test.doi {
+				t.Errorf("stored DOI = %q, want %q", stored.DOI, test.doi)
+			}
+		})
+	}
+}
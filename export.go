@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xitongsys/parquet-go-source/writer"
+	"github.com/xitongsys/parquet-go/source"
+	parquetwriter "github.com/xitongsys/parquet-go/writer"
+)
+
+// sink for converted records, written next to (or instead of) the metadata store
+type RecordWriter interface {
+	Write(item ArticleMetaInfo) error
+	Close() error
+}
+
+// "jsonl:path", "csv:path" or "parquet:path"
+func parseOutput(spec string) (format, path string, err error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("Invalid output '%s'. Should be 'format:path'", spec)
+	}
+
+	format, path = strings.ToLower(parts[0]), parts[1]
+	switch format {
+	case "jsonl", "csv", "parquet":
+	default:
+		return "", "", fmt.Errorf("Unknown output format '%s'. Possible formats - jsonl/csv/parquet", format)
+	}
+	return format, path, nil
+}
+
+// "jsonl:path", "csv:path" or "parquet:path", path "-" is standard output (it isn't closed).
+// With appending records are added to existing file (resumed run), parquet files can't be appended
+func NewRecordWriter(spec string, appending bool) (RecordWriter, error) {
+	format, path, err := parseOutput(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if appending && format == "parquet" && path != "-" {
+		return nil, fmt.Errorf("Parquet output '%s' can't be appended by resumed run, use jsonl or csv output", path)
+	}
+
+	// "-" - standard output
+	file := os.Stdout
+	if path != "-" {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if appending {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		if file, err = os.OpenFile(path, flags, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	var w RecordWriter
+	switch format {
+	case "jsonl":
+		w = &jsonlWriter{file: file, encoder: json.NewEncoder(file)}
+	case "csv":
+		w, err = newCSVWriter(file, appending)
+	case "parquet":
+		w, err = newParquetWriter(file)
+	}
+
+	if err != nil {
+		closeOutput(file)
+		return nil, err
+	}
+	return w, nil
+}
+
+// standard output stays open for other output
+func closeOutput(file *os.File) error {
+	if file == os.Stdout {
+		return nil
+	}
+	return file.Close()
+}
+
+// JSON Lines
+
+type jsonlWriter struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func (w *jsonlWriter) Write(item ArticleMetaInfo) error {
+	return w.encoder.Encode(item)
+}
+
+func (w *jsonlWriter) Close() error {
+	return closeOutput(w.file)
+}
+
+// CSV. Authors are joined by "; ", keywords, subjects and genres by ", "
+
+type csvWriter struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+var csvHeader = []string{
+	"DOI", "ISBN", "EISBN", "ISSN", "EISSN", "JournalID", "ContentType", "Genre",
+	"Subjects", "OnlineDate", "PrintDate", "Copyright", "Language",
+	"Authors", "Keywords", "Title", "Abstract", "PublicationName", "Number",
+	"PublicationDate", "Publisher", "Link", "PDFLink", "FileName", "FileSHA256", "FileSize", "JATSFileName", "OpenAccess",
+	"StartingPage", "EndingPage", "Volume", "ID",
+}
+
+// items stored before KeywordList was added have only space separated Keywords
+func keywordList(item ArticleMetaInfo) []string {
+	if item.KeywordList != nil {
+		return item.KeywordList
+	}
+	return strings.Fields(item.Keywords)
+}
+
+// header is written once, appended file already has it
+func newCSVWriter(file *os.File, appending bool) (*csvWriter, error) {
+	w := &csvWriter{file: file, writer: csv.NewWriter(file)}
+	if appending {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if info.Size() > 0 {
+			return w, nil
+		}
+	}
+
+	if err := w.writer.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *csvWriter) Write(item ArticleMetaInfo) error {
+	return w.writer.Write([]string{
+		item.DOI,
+		item.ISBN,
+		item.EISBN,
+		item.ISSN,
+		item.EISSN,
+		item.JournalID,
+		item.ContentType,
+		strings.Join(item.Genre, ", "),
+		strings.Join(item.Subjects, ", "),
+		item.OnlineDate,
+		item.PrintDate,
+		item.Copyright,
+		item.Language,
+		strings.Join(item.Authors, "; "),
+		strings.Join(keywordList(item), ", "),
+		item.Title,
+		item.Abstract,
+		item.PublicationName,
+		item.Number,
+		item.PublicationDate,
+		item.Publisher,
+		item.Link,
+		item.PDFLink,
+		item.FileName,
+		item.FileSHA256,
+		strconv.FormatInt(item.FileSize, 10),
+		item.JATSFileName,
+		strconv.FormatBool(item.OpenAccess),
+		strconv.Itoa(item.StartingPage),
+		strconv.Itoa(item.EndingPage),
+		strconv.Itoa(item.Volume),
+		strconv.Itoa(item.ID),
+	})
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		closeOutput(w.file)
+		return err
+	}
+	return closeOutput(w.file)
+}
+
+// Parquet
+
+// ArticleMetaInfo with parquet tags (parquet-go can't write plain int)
+type parquetRow struct {
+	DOI             string   `parquet:"name=DOI, type=UTF8"`
+	ISBN            string   `parquet:"name=ISBN, type=UTF8"`
+	EISBN           string   `parquet:"name=EISBN, type=UTF8"`
+	ISSN            string   `parquet:"name=ISSN, type=UTF8"`
+	EISSN           string   `parquet:"name=EISSN, type=UTF8"`
+	JournalID       string   `parquet:"name=JournalID, type=UTF8"`
+	ContentType     string   `parquet:"name=ContentType, type=UTF8"`
+	Genre           []string `parquet:"name=Genre, type=LIST, valuetype=UTF8"`
+	Subjects        []string `parquet:"name=Subjects, type=LIST, valuetype=UTF8"`
+	OnlineDate      string   `parquet:"name=OnlineDate, type=UTF8"`
+	PrintDate       string   `parquet:"name=PrintDate, type=UTF8"`
+	Copyright       string   `parquet:"name=Copyright, type=UTF8"`
+	Language        string   `parquet:"name=Language, type=UTF8"`
+	Authors         []string `parquet:"name=Authors, type=LIST, valuetype=UTF8"`
+	Keywords        []string `parquet:"name=Keywords, type=LIST, valuetype=UTF8"`
+	Title           string   `parquet:"name=Title, type=UTF8"`
+	Abstract        string   `parquet:"name=Abstract, type=UTF8"`
+	PublicationName string   `parquet:"name=PublicationName, type=UTF8"`
+	Number          string   `parquet:"name=Number, type=UTF8"`
+	PublicationDate string   `parquet:"name=PublicationDate, type=UTF8"`
+	Publisher       string   `parquet:"name=Publisher, type=UTF8"`
+	Link            string   `parquet:"name=Link, type=UTF8"`
+	PDFLink         string   `parquet:"name=PDFLink, type=UTF8"`
+	FileName        string   `parquet:"name=FileName, type=UTF8"`
+	FileSHA256      string   `parquet:"name=FileSHA256, type=UTF8"`
+	FileSize        int64    `parquet:"name=FileSize, type=INT64"`
+	JATSFileName    string   `parquet:"name=JATSFileName, type=UTF8"`
+	OpenAccess      bool     `parquet:"name=OpenAccess, type=BOOLEAN"`
+	StartingPage    int64    `parquet:"name=StartingPage, type=INT64"`
+	EndingPage      int64    `parquet:"name=EndingPage, type=INT64"`
+	Volume          int64    `parquet:"name=Volume, type=INT64"`
+	ID              int64    `parquet:"name=ID, type=INT64"`
+}
+
+func newParquetRow(item ArticleMetaInfo) parquetRow {
+	return parquetRow{
+		DOI:             item.DOI,
+		ISBN:            item.ISBN,
+		EISBN:           item.EISBN,
+		ISSN:            item.ISSN,
+		EISSN:           item.EISSN,
+		JournalID:       item.JournalID,
+		ContentType:     item.ContentType,
+		Genre:           item.Genre,
+		Subjects:        item.Subjects,
+		OnlineDate:      item.OnlineDate,
+		PrintDate:       item.PrintDate,
+		Copyright:       item.Copyright,
+		Language:        item.Language,
+		Authors:         item.Authors,
+		Keywords:        keywordList(item),
+		Title:           item.Title,
+		Abstract:        item.Abstract,
+		PublicationName: item.PublicationName,
+		Number:          item.Number,
+		PublicationDate: item.PublicationDate,
+		Publisher:       item.Publisher,
+		Link:            item.Link,
+		PDFLink:         item.PDFLink,
+		FileName:        item.FileName,
+		FileSHA256:      item.FileSHA256,
+		FileSize:        item.FileSize,
+		JATSFileName:    item.JATSFileName,
+		OpenAccess:      item.OpenAccess,
+		StartingPage:    int64(item.StartingPage),
+		EndingPage:      int64(item.EndingPage),
+		Volume:          int64(item.Volume),
+		ID:              int64(item.ID),
+	}
+}
+
+type parquetWriter struct {
+	file   *os.File
+	pfile  source.ParquetFile
+	writer *parquetwriter.ParquetWriter
+}
+
+func newParquetWriter(file *os.File) (*parquetWriter, error) {
+	pfile := writer.NewWriterFile(file)
+	pw, err := parquetwriter.NewParquetWriter(pfile, new(parquetRow), 4)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetWriter{file: file, pfile: pfile, writer: pw}, nil
+}
+
+func (w *parquetWriter) Write(item ArticleMetaInfo) error {
+	return w.writer.Write(newParquetRow(item))
+}
+
+func (w *parquetWriter) Close() error {
+	if err := w.writer.WriteStop(); err != nil {
+		closeOutput(w.file)
+		return err
+	}
+	return closeOutput(w.file)
+}
+
+// writes every record to all outputs, safe for concurrent use
+type exportWriters struct {
+	mutex   sync.Mutex
+	writers []RecordWriter
+}
+
+// Files of -output flags. Progress (or -format of query command) is printed to standard output,
+// so records can't be written there
+func newExportWriters(specs []string, appending bool) (*exportWriters, error) {
+	exports := &exportWriters{}
+	for _, spec := range specs {
+		if _, path, err := parseOutput(spec); err == nil && path == "-" {
+			exports.Close()
+			return nil, fmt.Errorf("Output '%s' can't be standard output, it is used by progress messages. Use a file path", spec)
+		}
+
+		w, err := NewRecordWriter(spec, appending)
+		if err != nil {
+			exports.Close()
+			return nil, err
+		}
+		exports.writers = append(exports.writers, w)
+	}
+	return exports, nil
+}
+
+func (e *exportWriters) Write(item ArticleMetaInfo) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, w := range e.writers {
+		if err := w.Write(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *exportWriters) Close() (err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, w := range e.writers {
+		if closeErr := w.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return
+}
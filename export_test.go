@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+var testRecords = []ArticleMetaInfo{
+	{DOI: "10.1/1", Title: "Binary Code", Authors: []string{"A. Author", "B. Author"}, Keywords: " decompilation binary code ", KeywordList: []string{"decompilation", "binary code"}, Volume: 3},
+	// stored before KeywordList was added
+	{DOI: "10.1/2", Title: "Old Item", Keywords: " obfuscation malware ", ID: 1},
+}
+
+// DOI and keywords joined by ", " of every record
+type exportedRecord struct {
+	DOI, Keywords string
+}
+
+var testExported = []exportedRecord{
+	{"10.1/1", "decompilation, binary code"},
+	{"10.1/2", "obfuscation, malware"},
+}
+
+func readJSONL(t *testing.T, path string) (records []exportedRecord) {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var item ArticleMetaInfo
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, exportedRecord{item.DOI, strings.Join(keywordList(item), ", ")})
+	}
+	return records
+}
+
+func readCSV(t *testing.T, path string) (records []exportedRecord) {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) == 0 || !reflect.DeepEqual(rows[0], csvHeader) {
+		t.Fatalf("no header: %v", rows)
+	}
+	column := make(map[string]int)
+	for i, name := range csvHeader {
+		column[name] = i
+	}
+	for _, row := range rows[1:] {
+		records = append(records, exportedRecord{row[column["DOI"]], row[column["Keywords"]]})
+	}
+	return records
+}
+
+func readParquet(t *testing.T, path string) (records []exportedRecord) {
+	file, err := local.NewLocalFileReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	pr, err := reader.NewParquetReader(file, new(parquetRow), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+
+	rows := make([]parquetRow, pr.GetNumRows())
+	if err = pr.Read(&rows); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		records = append(records, exportedRecord{row.DOI, strings.Join(row.Keywords, ", ")})
+	}
+	return records
+}
+
+func TestRecordWriters(t *testing.T) {
+	tests := []struct {
+		format string
+		read   func(t *testing.T, path string) []exportedRecord
+	}{
+		{"jsonl", readJSONL},
+		{"csv", readCSV},
+		{"parquet", readParquet},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			path := filepath.Join(newTestDir(t), "articles."+test.format)
+			w, err := NewRecordWriter(test.format+":"+path, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, item := range testRecords {
+				if err = w.Write(item); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err = w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if records := test.read(t, path); !reflect.DeepEqual(records, testExported) {
+				t.Errorf("records = %v, want %v", records, testExported)
+			}
+		})
+	}
+}
+
+func TestRecordWritersAppend(t *testing.T) {
+	tests := []struct {
+		format string
+		read   func(t *testing.T, path string) []exportedRecord
+	}{
+		{"jsonl", readJSONL},
+		{"csv", readCSV},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			spec := test.format + ":" + filepath.Join(newTestDir(t), "articles."+test.format)
+
+			// resumed run adds the second record, CSV header isn't repeated
+			for i, item := range testRecords {
+				w, err := NewRecordWriter(spec, i > 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err = w.Write(item); err != nil {
+					t.Fatal(err)
+				}
+				if err = w.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if records := test.read(t, strings.SplitN(spec, ":", 2)[1]); !reflect.DeepEqual(records, testExported) {
+				t.Errorf("records = %v, want %v", records, testExported)
+			}
+		})
+	}
+}
+
+func TestParquetAppendRefused(t *testing.T) {
+	path := filepath.Join(newTestDir(t), "articles.parquet")
+	if _, err := NewRecordWriter("parquet:"+path, true); err == nil {
+		t.Fatal("parquet output is appended")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("refused output is created: %v", err)
+	}
+}
+
+func TestNewRecordWriterInvalidSpec(t *testing.T) {
+	for _, spec := range []string{"articles.csv", "csv:", "xml:articles.xml"} {
+		if _, err := NewRecordWriter(spec, false); err == nil {
+			t.Errorf("%s: error expected", spec)
+		}
+	}
+}
+
+func TestExportWritersRejectStdout(t *testing.T) {
+	path := filepath.Join(newTestDir(t), "articles.jsonl")
+	if _, err := newExportWriters([]string{"jsonl:" + path, "csv:-"}, false); err == nil {
+		t.Fatal("standard output is accepted")
+	}
+
+	// query command prints -format records there and keeps it open
+	w, err := NewRecordWriter("jsonl:-", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stdout.Stat(); err != nil {
+		t.Errorf("standard output is closed: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Example:
+// subject (3 values):
+//
+//	Computer Science	120
+func printFacets(w io.Writer, response *SpringerResponse) {
+	fmt.Fprintf(w, "Found %d records\n", response.Result.Total)
+	if len(response.Facets) == 0 {
+		fmt.Fprintln(w, "No facets in response")
+		return
+	}
+
+	for _, facet := range response.Facets {
+		fmt.Fprintf(w, "\n%s (%d values):\n", facet.Name, len(facet.Values))
+		for _, value := range facet.Values {
+			fmt.Fprintf(w, "\t%s\t%d\n", value.Value, value.Count)
+		}
+	}
+}
+
+// writes facets to .json file or .csv file (facet,value,count)
+func writeFacets(path string, facets []SpringerFacet) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "\t")
+		err = encoder.Encode(facets)
+	} else {
+		w := csv.NewWriter(file)
+		w.Write([]string{"facet", "value", "count"})
+		for _, facet := range facets {
+			for _, value := range facet.Values {
+				w.Write([]string{facet.Name, value.Value, strconv.Itoa(value.Count)})
+			}
+		}
+		w.Flush()
+		err = w.Error()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,633 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+func newFakeSession(t *testing.T, handler http.Handler) *session.Session {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(server.URL),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:       aws.Int(0),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+// In-memory DynamoDB endpoint. Scan and Query return all items of the table (segment),
+// filter and key condition expressions are ignored
+type fakeDynamoDB struct {
+	mutex  sync.Mutex
+	tables map[string]*fakeTable
+
+	// names of called operations ("Scan", "PutItem"...)
+	calls []string
+}
+
+type fakeTable struct {
+	description *dynamodb.TableDescription
+	items       map[string]map[string]*dynamodb.AttributeValue
+}
+
+func newFakeDynamoDB() *fakeDynamoDB {
+	return &fakeDynamoDB{tables: make(map[string]*fakeTable)}
+}
+
+// creates table with the schema and items
+func (f *fakeDynamoDB) addTable(schema TableSchema, items ...ArticleMetaInfo) {
+	description := &dynamodb.TableDescription{
+		TableName:   aws.String(schema.Name),
+		TableStatus: aws.String(dynamodb.TableStatusActive),
+		KeySchema:   []*dynamodb.KeySchemaElement{{AttributeName: aws.String(schema.PrimaryKey), KeyType: aws.String(dynamodb.KeyTypeHash)}},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String(schema.PrimaryKey), AttributeType: aws.String(schema.PrimaryKeyType)},
+		},
+	}
+	if schema.HasSortKey() {
+		description.KeySchema = append(description.KeySchema, &dynamodb.KeySchemaElement{AttributeName: aws.String(schema.SortKey), KeyType: aws.String(dynamodb.KeyTypeRange)})
+		description.AttributeDefinitions = append(description.AttributeDefinitions, &dynamodb.AttributeDefinition{AttributeName: aws.String(schema.SortKey), AttributeType: aws.String(schema.SortKeyType)})
+	}
+	f.addTableDescription(description)
+
+	for _, item := range items {
+		av, err := dynamodbattribute.MarshalMap(item)
+		if err != nil {
+			panic(err)
+		}
+		f.tables[schema.Name].put(av)
+	}
+}
+
+func (f *fakeDynamoDB) addTableDescription(description *dynamodb.TableDescription) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.tables[aws.StringValue(description.TableName)] = &fakeTable{description: description, items: make(map[string]map[string]*dynamodb.AttributeValue)}
+}
+
+// stored items of the table sorted by key
+func (f *fakeDynamoDB) items(tablename string) []ArticleMetaInfo {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	table, ok := f.tables[tablename]
+	if !ok {
+		return nil
+	}
+
+	var items []ArticleMetaInfo
+	for _, av := range table.sorted() {
+		var item ArticleMetaInfo
+		if err := dynamodbattribute.UnmarshalMap(av, &item); err != nil {
+			panic(err)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func (f *fakeDynamoDB) called(operation string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var n int
+	for _, call := range f.calls {
+		if call == operation {
+			n++
+		}
+	}
+	return n
+}
+
+// "DOI\x00" key of an item or key attributes
+func (t *fakeTable) key(av map[string]*dynamodb.AttributeValue) string {
+	var key string
+	for _, element := range t.description.KeySchema {
+		if value, ok := av[aws.StringValue(element.AttributeName)]; ok {
+			key += aws.StringValue(value.S) + aws.StringValue(value.N)
+		}
+		key += "\x00"
+	}
+	return key
+}
+
+func (t *fakeTable) put(av map[string]*dynamodb.AttributeValue) {
+	t.items[t.key(av)] = av
+}
+
+func (t *fakeTable) sorted() []map[string]*dynamodb.AttributeValue {
+	keys := make([]string, 0, len(t.items))
+	for key := range t.items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	items := make([]map[string]*dynamodb.AttributeValue, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, t.items[key])
+	}
+	return items
+}
+
+type fakeDynamoDBError struct {
+	code    string
+	message string
+}
+
+func (f *fakeDynamoDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mutex.Lock()
+	f.calls = append(f.calls, operation)
+	output, fail := f.handle(operation, body)
+	f.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	if fail != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"__type":  "com.amazonaws.dynamodb.v20120810#" + fail.code,
+			"message": fail.message,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(output)
+}
+
+// must be called with mutex locked
+func (f *fakeDynamoDB) table(name *string) (*fakeTable, *fakeDynamoDBError) {
+	table, ok := f.tables[aws.StringValue(name)]
+	if !ok {
+		return nil, &fakeDynamoDBError{dynamodb.ErrCodeResourceNotFoundException, "Requested resource not found"}
+	}
+	return table, nil
+}
+
+func (f *fakeDynamoDB) handle(operation string, body []byte) (interface{}, *fakeDynamoDBError) {
+	decode := func(input interface{}) *fakeDynamoDBError {
+		if err := json.Unmarshal(body, input); err != nil {
+			return &fakeDynamoDBError{"SerializationException", err.Error()}
+		}
+		return nil
+	}
+
+	switch operation {
+	case "DescribeTable":
+		var input dynamodb.DescribeTableInput
+		if fail := decode(&input); fail != nil {
+			return nil, fail
+		}
+		table, fail := f.table(input.TableName)
+		if fail != nil {
+			return nil, fail
+		}
+		return &dynamodb.DescribeTableOutput{Table: table.description}, nil
+
+	case "ListTables":
+		var names []*string
+		for name := range f.tables {
+			names = append(names, aws.String(name))
+		}
+		return &dynamodb.ListTablesOutput{TableNames: names}, nil
+
+	case "DeleteTable":
+		var input dynamodb.DeleteTableInput
+		if fail := decode(&input); fail != nil {
+			return nil, fail
+		}
+		table, fail := f.table(input.TableName)
+		if fail != nil {
+			return nil, fail
+		}
+		delete(f.tables, aws.StringValue(input.TableName))
+		return &dynamodb.DeleteTableOutput{TableDescription: table.description}, nil
+
+	case "Scan":
+		var input dynamodb.ScanInput
+		if fail := decode(&input); fail != nil {
+			return nil, fail
+		}
+		table, fail := f.table(input.TableName)
+		if fail != nil {
+			return nil, fail
+		}
+
+		var items []map[string]*dynamodb.AttributeValue
+		for i, item := range table.sorted() {
+			if input.TotalSegments == nil || int64(i)%aws.Int64Value(input.TotalSegments) == aws.Int64Value(input.Segment) {
+				items = append(items, item)
+			}
+		}
+		return &dynamodb.ScanOutput{Items: items, Count: aws.Int64(int64(len(items)))}, nil
+
+	case "Query":
+		var input dynamodb.QueryInput
+		if fail := decode(&input); fail != nil {
+			return nil, fail
+		}
+		table, fail := f.table(input.TableName)
+		if fail != nil {
+			return nil, fail
+		}
+		items := table.sorted()
+		return &dynamodb.QueryOutput{Items: items, Count: aws.Int64(int64(len(items)))}, nil
+
+	case "GetItem":
+		var input dynamodb.GetItemInput
+		if fail := decode(&input); fail != nil {
+			return nil, fail
+		}
+		table, fail := f.table(input.TableName)
+		if fail != nil {
+			return nil, fail
+		}
+		return &dynamodb.GetItemOutput{Item: table.items[table.key(input.Key)]}, nil
+
+	case "PutItem":
+		var input dynamodb.PutItemInput
+		if fail := decode(&input); fail != nil {
+			return nil, fail
+		}
+		table, fail := f.table(input.TableName)
+		if fail != nil {
+			return nil, fail
+		}
+		if fail := validateFakeItem(table, input.Item); fail != nil {
+			return nil, fail
+		}
+
+		// only the condition of DataBase.Put: item of the same article or no item
+		existing, ok := table.items[table.key(input.Item)]
+		if input.ConditionExpression != nil && ok && existing["DOI"] != nil &&
+			aws.StringValue(existing["DOI"].S) != aws.StringValue(input.ExpressionAttributeValues[":doi"].S) {
+			return nil, &fakeDynamoDBError{dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed"}
+		}
+		table.put(input.Item)
+		return &dynamodb.PutItemOutput{}, nil
+
+	case "DeleteItem":
+		var input dynamodb.DeleteItemInput
+		if fail := decode(&input); fail != nil {
+			return nil, fail
+		}
+		table, fail := f.table(input.TableName)
+		if fail != nil {
+			return nil, fail
+		}
+		delete(table.items, table.key(input.Key))
+		return &dynamodb.DeleteItemOutput{}, nil
+
+	case "UpdateItem":
+		var input dynamodb.UpdateItemInput
+		if fail := decode(&input); fail != nil {
+			return nil, fail
+		}
+		table, fail := f.table(input.TableName)
+		if fail != nil {
+			return nil, fail
+		}
+
+		// only "REMOVE #name" with condition "#name = :value"
+		name := aws.StringValue(input.ExpressionAttributeNames["#file"])
+		item, ok := table.items[table.key(input.Key)]
+		if !ok || item[name] == nil || aws.StringValue(item[name].S) != aws.StringValue(input.ExpressionAttributeValues[":file"].S) {
+			return nil, &fakeDynamoDBError{dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed"}
+		}
+		delete(item, name)
+		return &dynamodb.UpdateItemOutput{}, nil
+
+	case "BatchWriteItem":
+		var input dynamodb.BatchWriteItemInput
+		if fail := decode(&input); fail != nil {
+			return nil, fail
+		}
+
+		// the whole request is rejected by invalid item
+		for name, requests := range input.RequestItems {
+			table, fail := f.table(aws.String(name))
+			if fail != nil {
+				return nil, fail
+			}
+			for _, request := range requests {
+				if request.PutRequest != nil {
+					if fail := validateFakeItem(table, request.PutRequest.Item); fail != nil {
+						return nil, fail
+					}
+				}
+			}
+		}
+
+		for name, requests := range input.RequestItems {
+			table := f.tables[name]
+			for _, request := range requests {
+				if request.PutRequest != nil {
+					table.put(request.PutRequest.Item)
+				} else {
+					delete(table.items, table.key(request.DeleteRequest.Key))
+				}
+			}
+		}
+		return &dynamodb.BatchWriteItemOutput{}, nil
+	}
+	return nil, &fakeDynamoDBError{"UnknownOperationException", operation}
+}
+
+// key attributes must be present and not empty, items with Title "invalid" are rejected too
+func validateFakeItem(table *fakeTable, item map[string]*dynamodb.AttributeValue) *fakeDynamoDBError {
+	for _, element := range table.description.KeySchema {
+		value, ok := item[aws.StringValue(element.AttributeName)]
+		if !ok || (value.S != nil && *value.S == "") {
+			return &fakeDynamoDBError{"ValidationException", "One or more parameter values are not valid. A value specified for a key attribute is empty"}
+		}
+	}
+	if title, ok := item["Title"]; ok && aws.StringValue(title.S) == "invalid" {
+		return &fakeDynamoDBError{"ValidationException", "Item size has exceeded the maximum allowed size"}
+	}
+	return nil
+}
+
+// DataBase of the fake endpoint, table is opened if it exists
+func newFakeDataBase(t *testing.T, fake *fakeDynamoDB, tablename string) *DataBase {
+	db := &DataBase{svc: dynamodb.New(newFakeSession(t, fake))}
+	if tablename != "" {
+		if err := db.OpenTable(context.Background(), tablename); err != nil {
+			t.Fatal(err)
+		}
+		db.batch.backoff = func(attempt int) time.Duration { return time.Millisecond }
+	}
+	return db
+}
+
+// In-memory S3 endpoint (path style): buckets, objects, listing by pages of pageSize, copy and batch delete
+type fakeS3 struct {
+	mutex    sync.Mutex
+	buckets  map[string]map[string]*fakeObject
+	pageSize int
+
+	// keys DeleteObjects fails to delete
+	undeletable map[string]bool
+}
+
+type fakeObject struct {
+	body         []byte
+	lastModified time.Time
+	metadata     map[string]string
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{buckets: make(map[string]map[string]*fakeObject), pageSize: 1000, undeletable: make(map[string]bool)}
+}
+
+func (f *fakeS3) addObject(bucketname, key, body string, lastModified time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.buckets[bucketname] == nil {
+		f.buckets[bucketname] = make(map[string]*fakeObject)
+	}
+	f.buckets[bucketname][key] = &fakeObject{body: []byte(body), lastModified: lastModified}
+}
+
+// keys of the bucket, nil if it doesn't exist
+func (f *fakeS3) keys(bucketname string) []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	bucket, ok := f.buckets[bucketname]
+	if !ok {
+		return nil
+	}
+	keys := []string{}
+	for key := range bucket {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path == "" {
+		f.listBuckets(w)
+		return
+	}
+
+	parts := strings.SplitN(path, "/", 2)
+	bucketname := parts[0]
+	bucket, exists := f.buckets[bucketname]
+	if len(parts) == 1 || parts[1] == "" {
+		f.serveBucket(w, r, bucketname, bucket, exists, body)
+		return
+	}
+
+	key := parts[1]
+	if !exists {
+		fakeS3Error(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	object, found := bucket[key]
+
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		if !found {
+			fakeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		for name, value := range object.metadata {
+			w.Header().Set("X-Amz-Meta-"+name, value)
+		}
+		w.Header().Set("Last-Modified", object.lastModified.UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.body)))
+		w.Header().Set("ETag", `"`+fakeETag(object.body)+`"`)
+		if r.Method == http.MethodGet {
+			w.Write(object.body)
+		}
+
+	case http.MethodPut:
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			source, _ = url.PathUnescape(source)
+			sourceParts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+			copied, ok := f.buckets[sourceParts[0]][sourceParts[1]]
+			if !ok {
+				fakeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+				return
+			}
+			bucket[key] = &fakeObject{body: copied.body, lastModified: time.Now(), metadata: copied.metadata}
+			fmt.Fprintf(w, `<CopyObjectResult><ETag>"%s"</ETag></CopyObjectResult>`, fakeETag(copied.body))
+			return
+		}
+
+		metadata := make(map[string]string)
+		for name := range r.Header {
+			if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") {
+				metadata[strings.ToLower(strings.TrimPrefix(strings.ToLower(name), "x-amz-meta-"))] = r.Header.Get(name)
+			}
+		}
+		bucket[key] = &fakeObject{body: body, lastModified: time.Now(), metadata: metadata}
+		w.Header().Set("ETag", `"`+fakeETag(body)+`"`)
+
+	case http.MethodDelete:
+		delete(bucket, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeS3) listBuckets(w http.ResponseWriter) {
+	var names []string
+	for name := range f.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprint(w, `<ListAllMyBucketsResult><Buckets>`)
+	for _, name := range names {
+		fmt.Fprintf(w, `<Bucket><Name>%s</Name></Bucket>`, name)
+	}
+	fmt.Fprint(w, `</Buckets></ListAllMyBucketsResult>`)
+}
+
+func (f *fakeS3) serveBucket(w http.ResponseWriter, r *http.Request, bucketname string, bucket map[string]*fakeObject, exists bool, body []byte) {
+	query := r.URL.Query()
+	if r.Method == http.MethodPut {
+		if !exists {
+			f.buckets[bucketname] = make(map[string]*fakeObject)
+		}
+		return
+	}
+	if !exists {
+		fakeS3Error(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodHead:
+
+	case r.Method == http.MethodDelete:
+		if len(bucket) > 0 {
+			fakeS3Error(w, r, http.StatusConflict, "BucketNotEmpty")
+			return
+		}
+		delete(f.buckets, bucketname)
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPost && hasQuery(query, "delete"):
+		var request struct {
+			Objects []struct {
+				Key string
+			} `xml:"Object"`
+		}
+		if err := xml.Unmarshal(body, &request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		fmt.Fprint(w, `<DeleteResult>`)
+		for _, object := range request.Objects {
+			if f.undeletable[object.Key] {
+				fmt.Fprintf(w, `<Error><Key>%s</Key><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`, object.Key)
+				continue
+			}
+			delete(bucket, object.Key)
+		}
+		fmt.Fprint(w, `</DeleteResult>`)
+
+	case r.Method == http.MethodGet && query.Get("list-type") == "2":
+		var keys []string
+		for key := range bucket {
+			if strings.HasPrefix(key, query.Get("prefix")) && key > query.Get("continuation-token") {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		truncated := len(keys) > f.pageSize
+		if truncated {
+			keys = keys[:f.pageSize]
+		}
+
+		fmt.Fprintf(w, `<ListBucketResult><Name>%s</Name><KeyCount>%d</KeyCount><IsTruncated>%v</IsTruncated>`, bucketname, len(keys), truncated)
+		if truncated {
+			fmt.Fprintf(w, `<NextContinuationToken>%s</NextContinuationToken>`, keys[len(keys)-1])
+		}
+		for _, key := range keys {
+			object := bucket[key]
+			fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>%d</Size><ETag>"%s"</ETag><LastModified>%s</LastModified></Contents>`,
+				key, len(object.body), fakeETag(object.body), object.lastModified.UTC().Format(time.RFC3339))
+		}
+		fmt.Fprint(w, `</ListBucketResult>`)
+
+	default:
+		fakeS3Error(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func hasQuery(query url.Values, name string) bool {
+	_, ok := query[name]
+	return ok
+}
+
+func fakeS3Error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		fmt.Fprintf(w, `<Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+	}
+}
+
+func fakeETag(body []byte) string {
+	sum := md5.Sum(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// S3Manager of the fake endpoint, bucket is used as BlobStore
+func newFakeS3Manager(t *testing.T, fake *fakeS3, bucketname string) *S3Manager {
+	sess := newFakeSession(t, fake)
+	return &S3Manager{
+		svc:        s3.New(sess),
+		uploader:   s3manager.NewUploader(sess),
+		downloader: s3manager.NewDownloader(sess),
+		bucket:     bucketname,
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+)
+
+// Naming of uploaded PDF and full text files
+const (
+	fileKeysSHA256 = "sha256" // hash of content, identical files are stored once
+	fileKeysDOI    = "doi"    // one file per article, hash is used for records without DOI
+)
+
+// hex SHA-256 of content
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// name is known before the content is read
+func hasDOIKey(naming, doi string) bool {
+	return naming == fileKeysDOI && doi != ""
+}
+
+// Keys are flat file names, escaped DOI has no "/" and is a valid file name on every system:
+// 10.1007/s11276-008-0131-4 -> 10.1007%2Fs11276-008-0131-4.pdf
+func fileKey(naming, doi, hash, extension string) string {
+	if hasDOIKey(naming, doi) {
+		return url.QueryEscape(doi) + extension
+	}
+	return hash + extension
+}
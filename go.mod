@@ -5,4 +5,7 @@ go 1.14
 require (
 	github.com/akmubi/soup v1.1.1
 	github.com/aws/aws-sdk-go v1.34.5
+	github.com/xitongsys/parquet-go v1.5.1
+	github.com/xitongsys/parquet-go-source v0.0.0-20190524061010-2b72cbee77d5
+	gopkg.in/yaml.v2 v2.2.8
 )
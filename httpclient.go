@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBadAPIKey = errors.New("Springer API key is invalid or inactive")
+	ErrTransient = errors.New("Temporary failure")
+)
+
+// Failed request. Kind is ErrQuotaExceeded, ErrBadAPIKey, ErrTransient
+// or nil for other failures (404, not accessible PDF...), so errors.Is(err, ErrTransient) works
+type HTTPError struct {
+	URL        string
+	StatusCode int // 0 if no response
+	Kind       error
+	Err        error
+}
+
+func (e *HTTPError) Error() string {
+	var reason string
+	switch {
+	case e.Err != nil:
+		reason = e.Err.Error()
+	case e.StatusCode != 0:
+		reason = http.StatusText(e.StatusCode)
+		if reason == "" {
+			reason = "status " + strconv.Itoa(e.StatusCode)
+		}
+	}
+
+	if e.Kind != nil && e.Kind != ErrTransient {
+		return fmt.Sprintf("%v: %s (%s)", e.Kind, reason, e.URL)
+	}
+	return fmt.Sprintf("%s - %s", reason, e.URL)
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Kind
+}
+
+// http.Client with rate limit and retries of transient failures
+type HTTPClient struct {
+	client  *http.Client
+	limiter *RateLimiter
+
+	// 401/403 are caused by API key, not by the resource
+	keyed bool
+
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+func NewHTTPClient(limiter *RateLimiter, keyed bool, timeout time.Duration, retries int) *HTTPClient {
+	return &HTTPClient{
+		client:     &http.Client{Timeout: timeout},
+		limiter:    limiter,
+		keyed:      keyed,
+		retries:    retries,
+		backoff:    time.Second,
+		maxBackoff: 2 * time.Minute,
+	}
+}
+
+// Client of downloads streamed by caller. Timeout covers connecting and waiting for response headers,
+// reading of the body isn't limited, so large files on slow connections are not cut off (ctx cancels it)
+func NewStreamHTTPClient(limiter *RateLimiter, timeout time.Duration, retries int) *HTTPClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = timeout
+	transport.ResponseHeaderTimeout = timeout
+
+	client := NewHTTPClient(limiter, false, 0, retries)
+	client.client = &http.Client{Transport: transport}
+	return client
+}
+
+// clients of outbound requests, set from flags
+var springerClient, landingClient, pdfClient *HTTPClient
+
+// Sends GET request, retrying transient failures. Only 2xx responses are returned,
+// body must be closed by caller
+func (c *HTTPClient) Get(ctx context.Context, rawurl string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		response, err := c.client.Do(request)
+		if err == nil && response.StatusCode >= 200 && response.StatusCode < 300 {
+			return response, nil
+		}
+
+		// cancelled requests are not retried
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var retryAfter time.Duration
+		if err != nil {
+			err = &HTTPError{URL: redactURL(rawurl), Kind: ErrTransient, Err: unwrapURLError(err)}
+		} else {
+			retryAfter = parseRetryAfter(response.Header.Get("Retry-After"))
+			err = c.classify(rawurl, response)
+		}
+
+		if !errors.Is(err, ErrTransient) || attempt >= c.retries {
+			return nil, err
+		}
+
+		delay := c.delay(attempt)
+		if retryAfter > delay {
+			// server asks to wait longer than we are ready to
+			if retryAfter > c.maxBackoff {
+				return nil, err
+			}
+			delay = retryAfter
+		}
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Sends GET request and reads whole body
+func (c *HTTPClient) GetBody(ctx context.Context, rawurl string) ([]byte, error) {
+	response, err := c.Get(ctx, rawurl)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, &HTTPError{URL: redactURL(rawurl), Kind: ErrTransient, Err: err}
+	}
+	return body, nil
+}
+
+// closes response
+func (c *HTTPClient) classify(rawurl string, response *http.Response) error {
+	// Springer explains 401/403/429 in the body: "Account Over Queries Per Day Limit"...
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 4096))
+	response.Body.Close()
+	text := strings.ToLower(string(message))
+
+	httpErr := &HTTPError{URL: redactURL(rawurl), StatusCode: response.StatusCode}
+	switch code := response.StatusCode; {
+	case c.keyed && (strings.Contains(text, "per day") || strings.Contains(text, "quota")):
+		httpErr.Kind = ErrQuotaExceeded
+	case code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500:
+		httpErr.Kind = ErrTransient
+	case c.keyed && strings.Contains(text, "rate limit"):
+		httpErr.Kind = ErrTransient
+	case c.keyed && (code == http.StatusUnauthorized || code == http.StatusForbidden):
+		httpErr.Kind = ErrBadAPIKey
+	}
+	return httpErr
+}
+
+// exponential backoff with jitter: random value in [d/2, d], d = backoff * 2^attempt
+func (c *HTTPClient) delay(attempt int) time.Duration {
+	d := c.backoff << uint(attempt)
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Retry-After: 120 or Retry-After: Fri, 31 Dec 1999 23:59:59 GMT
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// API key is not shown in errors
+func redactURL(rawurl string) string {
+	parsed, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+
+	query := parsed.Query()
+	if query.Get("api_key") != "" {
+		query.Set("api_key", "hidden")
+		parsed.RawQuery = query.Encode()
+	}
+	return parsed.String()
+}
+
+// *url.Error contains URL with API key
+func unwrapURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
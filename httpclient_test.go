@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name   string
+		keyed  bool
+		status int
+		body   string
+		kind   error
+	}{
+		{"quota", true, http.StatusForbidden, "Account Over Queries Per Day Limit", ErrQuotaExceeded},
+		{"quota in 429", true, http.StatusTooManyRequests, "Developer Over Qps ... daily quota", ErrQuotaExceeded},
+		{"rate limit", true, http.StatusForbidden, "Account Over Rate Limit", ErrTransient},
+		{"too many requests", false, http.StatusTooManyRequests, "", ErrTransient},
+		{"request timeout", false, http.StatusRequestTimeout, "", ErrTransient},
+		{"server error", true, http.StatusBadGateway, "", ErrTransient},
+		{"bad key", true, http.StatusUnauthorized, "Invalid authentication credentials", ErrBadAPIKey},
+		{"forbidden key", true, http.StatusForbidden, "Inactive key", ErrBadAPIKey},
+		{"forbidden PDF", false, http.StatusForbidden, "Access denied", nil},
+		{"not found", true, http.StatusNotFound, "", nil},
+		{"not found PDF mentioning quota", false, http.StatusNotFound, "quota", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &HTTPClient{keyed: test.keyed}
+			response := &http.Response{StatusCode: test.status, Body: ioutil.NopCloser(strings.NewReader(test.body))}
+
+			err := client.classify("http://api.springernature.com/meta/v2/pam?q=a&api_key=secret", response)
+			var httpErr *HTTPError
+			if !errors.As(err, &httpErr) {
+				t.Fatalf("error = %v, want *HTTPError", err)
+			}
+			if httpErr.Kind != test.kind {
+				t.Errorf("kind = %v, want %v", httpErr.Kind, test.kind)
+			}
+			if httpErr.StatusCode != test.status {
+				t.Errorf("status = %d, want %d", httpErr.StatusCode, test.status)
+			}
+			if strings.Contains(err.Error(), "secret") {
+				t.Errorf("API key is shown in error: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 120 * time.Second, 120 * time.Second},
+		{" 5 ", 5 * time.Second, 5 * time.Second},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{"Fri, 31 Dec 1999 23:59:59 GMT", -100 * 365 * 24 * time.Hour, 0},
+		{"soon", 0, 0},
+	}
+
+	for _, test := range tests {
+		if d := parseRetryAfter(test.value); d < test.min || d > test.max {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v-%v", test.value, d, test.min, test.max)
+		}
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		url, redacted string
+	}{
+		{"http://api.springernature.com/meta/v2/pam?api_key=secret&q=a", "http://api.springernature.com/meta/v2/pam?api_key=hidden&q=a"},
+		{"https://link.springer.com/content/pdf/10.1007/a.pdf", "https://link.springer.com/content/pdf/10.1007/a.pdf"},
+	}
+
+	for _, test := range tests {
+		if redacted := redactURL(test.url); redacted != test.redacted {
+			t.Errorf("redactURL(%s) = %s, want %s", test.url, redacted, test.redacted)
+		}
+	}
+}
+
+func TestDelay(t *testing.T) {
+	client := &HTTPClient{backoff: time.Second, maxBackoff: 2 * time.Minute}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, time.Second},
+		{3, 8 * time.Second},
+		{7, 2 * time.Minute},
+		{70, 2 * time.Minute},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 20; i++ {
+			if d := client.delay(test.attempt); d < test.max/2 || d > test.max {
+				t.Fatalf("delay(%d) = %v, want %v-%v", test.attempt, d, test.max/2, test.max)
+			}
+		}
+	}
+}
+
+func TestGetRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int // responses of consecutive attempts
+		retryAfter string
+		retries    int
+		requests   int
+		kind       error // nil - success
+	}{
+		{"success", []int{200}, "", 3, 1, nil},
+		{"transient failures", []int{503, 429, 200}, "", 3, 3, nil},
+		{"retries used up", []int{500, 500, 500, 500}, "", 2, 3, ErrTransient},
+		{"not found isn't retried", []int{404, 200}, "", 3, 1, nil},
+		{"bad key isn't retried", []int{401, 200}, "", 3, 1, ErrBadAPIKey},
+		{"retry after too long", []int{429, 200}, "3600", 3, 1, ErrTransient},
+		{"retry after", []int{429, 200}, "0", 3, 2, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := test.statuses[requests]
+				requests++
+				if test.retryAfter != "" {
+					w.Header().Set("Retry-After", test.retryAfter)
+				}
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			client := NewHTTPClient(nil, true, time.Second, test.retries)
+			client.backoff, client.maxBackoff = time.Millisecond, 10*time.Millisecond
+
+			response, err := client.Get(context.Background(), server.URL)
+			if err == nil {
+				response.Body.Close()
+			}
+
+			if requests != test.requests {
+				t.Errorf("%d requests, want %d", requests, test.requests)
+			}
+			switch {
+			case test.statuses[test.requests-1] == http.StatusNotFound:
+				var httpErr *HTTPError
+				if !errors.As(err, &httpErr) || httpErr.Kind != nil {
+					t.Errorf("error = %v, want not found", err)
+				}
+			case test.kind == nil && err != nil:
+				t.Errorf("error = %v", err)
+			case test.kind != nil && !errors.Is(err, test.kind):
+				t.Errorf("error = %v, want %v", err, test.kind)
+			}
+		})
+	}
+}
+
+func TestGetCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(nil, false, time.Second, 10)
+	client.backoff, client.maxBackoff = time.Hour, time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := client.Get(ctx, server.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want context.DeadlineExceeded", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("cancelled request is still retried")
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"gopkg.in/yaml.v2"
+)
+
+// DynamoDB limit of global secondary indexes per table
+const maxIndexes = 20
+
+// Global secondary index of the metadata table. Key types are taken from ArticleMetaInfo fields
+type IndexSchema struct {
+	Name     string `yaml:"name"`
+	HashKey  string `yaml:"hash"`
+	RangeKey string `yaml:"range"`
+
+	// ALL (default), KEYS_ONLY or INCLUDE
+	Projection       string   `yaml:"projection"`
+	NonKeyAttributes []string `yaml:"attributes"`
+}
+
+// Schema file (.yaml):
+//
+// indexes:
+//   - name: ByPublication
+//     hash: PublicationName
+//     range: PublicationDate
+//   - name: ByPublisher
+//     hash: Publisher
+//     range: PublicationDate
+//     projection: INCLUDE
+//     attributes: [Title, DOI]
+type schemaFile struct {
+	Indexes []IndexSchema `yaml:"indexes"`
+}
+
+func loadIndexes(path string) ([]IndexSchema, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file schemaFile
+	if err = yaml.UnmarshalStrict(content, &file); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	for i := range file.Indexes {
+		if file.Indexes[i].Projection == "" {
+			file.Indexes[i].Projection = dynamodb.ProjectionTypeAll
+		}
+	}
+	return file.Indexes, nil
+}
+
+// DynamoDB type of ArticleMetaInfo field, only strings and numbers can be keys
+func articleAttributeType(name string) (string, error) {
+	field, ok := reflect.TypeOf(ArticleMetaInfo{}).FieldByName(name)
+	if !ok {
+		return "", fmt.Errorf("Article has no attribute '%s'", name)
+	}
+
+	switch field.Type.Kind() {
+	case reflect.String:
+		return "S", nil
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return "N", nil
+	}
+	return "", fmt.Errorf("Attribute '%s' (%s) can't be a key. Should be string or number", name, field.Type)
+}
+
+// hash and range key attributes
+func (index IndexSchema) keys() (keys []string) {
+	keys = append(keys, index.HashKey)
+	if index.RangeKey != "" {
+		keys = append(keys, index.RangeKey)
+	}
+	return
+}
+
+func (s TableSchema) validateIndexes() error {
+	if len(s.Indexes) > maxIndexes {
+		return fmt.Errorf("Too many indexes (%d), max %d", len(s.Indexes), maxIndexes)
+	}
+
+	names := make(map[string]bool)
+	for _, index := range s.Indexes {
+		if index.Name == "" || index.HashKey == "" {
+			return errors.New("Index must have name and hash key")
+		}
+		if names[index.Name] {
+			return fmt.Errorf("Duplicate index name '%s'", index.Name)
+		}
+		names[index.Name] = true
+
+		for _, key := range index.keys() {
+			keyType, err := articleAttributeType(key)
+			if err != nil {
+				return fmt.Errorf("Index '%s': %v", index.Name, err)
+			}
+
+			// attribute is defined once for table and indexes
+			if (key == s.PrimaryKey && keyType != s.PrimaryKeyType) || (key == s.SortKey && keyType != s.SortKeyType) {
+				return fmt.Errorf("Index '%s': attribute '%s' is %s, but table key type is different", index.Name, key, keyType)
+			}
+		}
+
+		switch index.Projection {
+		case dynamodb.ProjectionTypeAll, dynamodb.ProjectionTypeKeysOnly:
+			if len(index.NonKeyAttributes) > 0 {
+				return fmt.Errorf("Index '%s': attributes can be used only with INCLUDE projection", index.Name)
+			}
+		case dynamodb.ProjectionTypeInclude:
+			if len(index.NonKeyAttributes) == 0 {
+				return fmt.Errorf("Index '%s': INCLUDE projection requires attributes", index.Name)
+			}
+		default:
+			return fmt.Errorf("Index '%s': incorrect projection '%s'. Should be ALL, KEYS_ONLY or INCLUDE", index.Name, index.Projection)
+		}
+	}
+	return nil
+}
+
+// adds indexes and their key attributes to new table
+func (db *DataBase) applyIndexes(input *dynamodb.CreateTableInput) {
+	defined := make(map[string]bool)
+	for _, definition := range input.AttributeDefinitions {
+		defined[aws.StringValue(definition.AttributeName)] = true
+	}
+
+	for _, index := range db.schema.Indexes {
+		keySchema := []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String(index.HashKey), KeyType: aws.String(dynamodb.KeyTypeHash)},
+		}
+		if index.RangeKey != "" {
+			keySchema = append(keySchema, &dynamodb.KeySchemaElement{AttributeName: aws.String(index.RangeKey), KeyType: aws.String(dynamodb.KeyTypeRange)})
+		}
+
+		for _, key := range index.keys() {
+			if !defined[key] {
+				keyType, _ := articleAttributeType(key)
+				input.AttributeDefinitions = append(input.AttributeDefinitions, &dynamodb.AttributeDefinition{
+					AttributeName: aws.String(key),
+					AttributeType: aws.String(keyType),
+				})
+				defined[key] = true
+			}
+		}
+
+		projection := &dynamodb.Projection{ProjectionType: aws.String(index.Projection)}
+		if len(index.NonKeyAttributes) > 0 {
+			projection.NonKeyAttributes = aws.StringSlice(index.NonKeyAttributes)
+		}
+
+		gsi := &dynamodb.GlobalSecondaryIndex{
+			IndexName:  aws.String(index.Name),
+			KeySchema:  keySchema,
+			Projection: projection,
+		}
+		// indexes of provisioned table have their own capacity
+		if input.ProvisionedThroughput != nil {
+			gsi.ProvisionedThroughput = &dynamodb.ProvisionedThroughput{
+				ReadCapacityUnits:  input.ProvisionedThroughput.ReadCapacityUnits,
+				WriteCapacityUnits: input.ProvisionedThroughput.WriteCapacityUnits,
+			}
+		}
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, gsi)
+	}
+}
+
+// Existing table must have every index of the schema with the same keys, other indexes are ignored
+func (s TableSchema) indexProblems(table *dynamodb.TableDescription) (problems []string) {
+	existing := make(map[string]*dynamodb.GlobalSecondaryIndexDescription)
+	for _, gsi := range table.GlobalSecondaryIndexes {
+		existing[aws.StringValue(gsi.IndexName)] = gsi
+	}
+
+	for _, index := range s.Indexes {
+		gsi, ok := existing[index.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("index '%s' is missing", index.Name))
+			continue
+		}
+
+		hashKey, rangeKey := keyNames(gsi.KeySchema)
+		if hashKey != index.HashKey || rangeKey != index.RangeKey {
+			problems = append(problems, fmt.Sprintf("index '%s' has keys %s, expected %s",
+				index.Name, formatKeys(hashKey, rangeKey), formatKeys(index.HashKey, index.RangeKey)))
+		}
+	}
+	return
+}
+
+func formatKeys(hashKey, rangeKey string) string {
+	if rangeKey == "" {
+		return hashKey
+	}
+	return hashKey + "+" + rangeKey
+}
+
+// Items without index key are not indexed (sparse index), but NULL or empty key is rejected
+func (db *DataBase) removeEmptyIndexKeys(item map[string]*dynamodb.AttributeValue) {
+	for _, index := range db.schema.Indexes {
+		for _, key := range index.keys() {
+			if av, ok := item[key]; ok && (aws.BoolValue(av.NULL) || (av.S != nil && *av.S == "")) {
+				delete(item, key)
+			}
+		}
+	}
+}
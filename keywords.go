@@ -1,17 +1,18 @@
 package main
 
 import (
+	"context"
 	"github.com/akmubi/soup"
 	"strings"
 )
 
-func parseKeywords(url string) (keywords []string, err error) {
-	response, err := soup.Get(url)
+func parseKeywords(ctx context.Context, url string) (keywords []string, err error) {
+	response, err := landingClient.GetBody(ctx, url)
 	if err != nil {
 		return nil, err
 	}
 
-	document := soup.HTMLParse(response)
+	document := soup.HTMLParse(string(response))
 	divs := document.FindAll("div")
 	for _, div := range divs {
 		if div.Attrs()["class"] == "KeywordGroup" {
@@ -1,624 +1,843 @@
-package main
-
-import (
-	"encoding/xml"
-	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
-	"net/http"
-	"os"
-	"strconv"
-	"unicode"
-	"strings"
-	"sync"
-	"errors"
-	"time"
-	"flag"
-)
-
-func check(err error) {
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
-const springerAPIdomain	= "http://api.springernature.com/"
-var apiKey string
-
-
-
-// allowed charactes: '-', '_', '*', '"', '~', '.', '<', '>'
-// Example: "**Springer Link**" -> "**Springer%20Link**"
-func replaceNonLetters(source string) (result string) {
-
-	for _, rune := range source {
-		if ((rune == '-') || (rune == '*') || (rune == '_') ||
-			(rune == '"') || (rune == '~') || (rune == '.')) ||
-			(rune == '<') || (rune == '>') || (rune == ':') ||
-			(unicode.IsLetter(rune)) || (unicode.IsDigit(rune)) {
-			result += string(rune)
-		} else {
-			result += fmt.Sprintf("%%%X", int(rune))
-		}
-	}
-	return
-}
-
-// "@sample string/hello !!!\u32a7" -> "sample_string_hello"
-func MakeStringPretty(source string) (result string) {
-	// source = removeForbiddenChars(source)
-	for _, rune := range source {
-		if (unicode.IsLetter(rune) || unicode.IsDigit(rune)) {
-			result += string(rune)
-		} else if unicode.IsSpace(rune) || rune == '\\' || rune == '/' {
-			result += "_"
-		} else {
-			result += ""
-		}
-	}
-
-	// " _sample_string_hello__" -> "sample_string_hello" 
-	result = strings.Trim(result, " _")
-	return
-}
-
-type SpringerResult struct {
-	Total            int `xml:"total"`
-	Start            int `xml:"start"`
-	PageLength       int `xml:"pageLength"`
-	RecordsDisplayed int `xml:"recordsDisplayed"`
-}
-
-type SpringerArticle struct {
-	Title           string  	`xml:"title" json:"title"`
-	Creators        []string	`xml:"creator" json:"authors"`
-	PublicationName string  	`xml:"publicationName" json:"publication_name"`
-	Volume          int     	`xml:"volume" json:"volume"`
-	Number          string  	`xml:"number" json:"number"`
-	OpenAccess	bool		`xml:"openAccess" json:"open_access"`
-	StartingPage    int   		`xml:"startingPage" json:"starting_page"`
-	EndingPage      int   		`xml:"endingPage" json:"ending_page"`
-	Publisher       string		`xml:"publisher" json:"publisher"`
-	PublicationDate string		`xml:"publicationDate" json:"publication_date"`
-	URL             string		`xml:"url" json:"url"`
-}
-
-type SpringerRecord struct {
-	Article  SpringerArticle `xml:"head>article" json:"article_info"`
-	Abstract string          `xml:"body>p" json:"abstract"`
-}
-
-type SpringerResponse struct {
-	XMLName xml.Name         `xml:"response"`
-	Result  SpringerResult   `xml:"result"`
-	Records []SpringerRecord `xml:"records>message" json:"articles"`
-}
-
-// database respresentation
-type ArticleMetaInfo struct {
-	Authors			[]string
-	Keywords		string
-	Title			string
-	Abstract		string
-	PublicationName 	string
-	Number			string
-	PublicationDate 	string
-	Publisher		string
-	Link			string
-	PDFLink			string
-	FileName		string
-	OpenAccess		bool
-	AlwaysTheSame		int
-	StartingPage		int   
-	EndingPage		int
-	Volume			int   
-	ID			int
-}
-
-func isPDFAvailable(pdfLink string) bool {
-	response, err := http.Get(pdfLink)
-	defer response.Body.Close()
-	if err != nil {
-		return false
-	}
-
-	result, err := ioutil.ReadAll(response.Body)
-	if err != nil || len(result) == 0 {
-		return false
-	}
-
-	if string(result[:4]) != "%PDF" {
-		return false
-	}
-	return true
-}
-
-func (a *ArticleMetaInfo) Convert(record SpringerRecord) {
-	a.Authors = record.Article.Creators
-	a.Title = record.Article.Title
-	a.Abstract = record.Abstract
-	a.PublicationName = record.Article.PublicationName
-	a.Number = record.Article.Number
-	a.PublicationDate = record.Article.PublicationDate
-	a.Publisher = record.Article.Publisher
-	a.Link = record.Article.URL
-	springerKeywords, err := parseKeywords(a.Link);
-	if err != nil {
-		log.Println("Parsing keywords:", err)
-	}
-	a.Keywords = " "  
-	localKeywords := append([]string{ strings.ToLower(keywords) }, springerKeywords...)
-	for _, keyword := range localKeywords {
-		a.Keywords += strings.TrimSpace(keyword) + " "
-	}
-	a.OpenAccess = record.Article.OpenAccess
-	a.AlwaysTheSame = 1
-	pdfLink := "https://link.springer.com/content/pdf/" + strings.Replace(strings.TrimPrefix(a.Link, "http://dx.doi.org/"), "/", "%2F", -1) + ".pdf"
-	if isPDFAvailable(pdfLink) {
-		a.PDFLink = pdfLink
-	}
-
-	a.Volume = record.Article.Volume
-	a.StartingPage = record.Article.StartingPage
-	a.EndingPage = record.Article.EndingPage
-}
-
-func formQuery(startPage int, searchQuery string) string {
-	return springerAPIdomain +
-		"metadata/pam" +
-		"?q=" +
-		searchQuery +
-		"&s=" + strconv.Itoa(startPage) +
-		"&p=" + strconv.Itoa(pageLength) +
-		"&api_key=" + apiKey
-}
-
-var pageCounter, recordCounter int
-
-func getPages(numworkers, numjobs int, jobs <- chan string, done chan<- error) <-chan SpringerRecord {
-	records := make(chan SpringerRecord, numjobs * pageLength)
-
-	for i := 0; i < numworkers; i++ {
-		go func() {
-			for j := range jobs {
-				response, err := http.Get(j)
-				if err != nil {
-					done <- err
-					continue
-				}
-
-				result, err := ioutil.ReadAll(response.Body)
-				response.Body.Close()
-
-				if err != nil {
-					done <- err
-					continue
-				}
-
-				var page SpringerResponse
-				if err = xml.Unmarshal(result, &page); err != nil {
-					done <- err
-					continue
-				}
-
-				for _, record := range page.Records {
-					records <- record
-				}
-				
-				// update page counter
-				var mutex sync.Mutex
-				mutex.Lock()
-				pageCounter++
-				recordCounter += len(page.Records)
-				mutex.Unlock()
-
-				fmt.Printf("Passed: %d page(-s)\n", pageCounter)
-				time.Sleep(timeoutDuration * time.Second)
-				done <- nil
-			}
-		}()
-	}
-	return records
-}
-
-var itemCounter int
-
-func storeMeta(database *DataBase, manager *S3Manager, numworkers, numjobs int, records <-chan SpringerRecord) <-chan error {
-	done := make(chan error, numjobs * pageLength)
-	fmt.Println("Starting uploading records")
-
-	for i := 0; i < numworkers; i++ {
-		go func(workerID int) {
-			for record := range records {
-				var articleMeta ArticleMetaInfo
-				articleMeta.Convert(record)
-
-				if needUpload && articleMeta.PDFLink != "" {
-
-					filename := MakeStringPretty(articleMeta.Title) + ".pdf"
-
-					response, err := http.Get(articleMeta.PDFLink)
-					if err != nil {
-						done <- err
-						continue
-					}
-
-					pdfFile, err := os.Create(filename)
-					if err != nil {
-						done <- err
-						continue
-					}
-
-					_, err = io.Copy(pdfFile, response.Body)
-					response.Body.Close()
-					
-					if err != nil {
-						done <- err
-						pdfFile.Close()
-						os.Remove(pdfFile.Name())
-						continue
-					}
-
-					if _, err = pdfFile.Seek(0, io.SeekStart); err != nil {
-						done <- err
-						pdfFile.Close()
-						os.Remove(pdfFile.Name())
-						continue
-					}
-
-					// %PDF
-					pdfSignature := make([]byte, 4)
-
-					if _, err = pdfFile.Read(pdfSignature); err != nil {
-						done <- err
-						pdfFile.Close()
-						os.Remove(pdfFile.Name())
-						continue
-					}
-
-					if string(pdfSignature) != "%PDF" {
-						done <- errors.New(fmt.Sprint("Not a PDF - ", articleMeta.PDFLink))
-						pdfFile.Close()
-						os.Remove(pdfFile.Name())
-						continue
-					}
-
-					fmt.Println("Uploading -", filename)
-					
-					articleMeta.FileName = filename
-					err = manager.UploadFile(bucketName, pdfFile)
-					
-					// close and remove
-					pdfFile.Close()
-					os.Remove(pdfFile.Name())
-
-					if err != nil {
-						done <- err
-						continue
-					}
-				}
-
-				// updating item counter
-				var mutex sync.Mutex
-				mutex.Lock()
-				articleMeta.ID = itemCounter
-				itemCounter++
-				mutex.Unlock()
-				fmt.Printf("Inserting '%s' into '%s'\n", articleMeta.Title, tableName)
-				err := database.PutItem(tableName, articleMeta)
-				done <- err
-			}
-		}(i)
-	}
-	return done
-}
-
-func handleErrors(errorCount int, results <-chan error) (receivedErrors []error) {
-	// receive results
-	for i := 0; i < errorCount; i++ {
-		workerErr := <-results
-		if workerErr != nil {
-			receivedErrors = append(receivedErrors, workerErr)
-		}
-	}
-	return
-}
-
-var pageLength int
-var timeoutDuration time.Duration
-
-var tableName, primaryKey, primaryKeyType, sortKey, sortKeyType string 
-
-var bucketName string
-var needUpload bool
-
-var keywords string
-
-func main() {
-
-	start := time.Now()
-
-	// flags
-
-	// springer API
-	apiKeyPtr		:= flag.String	("apikey",	"",		"Spinger API Key")
-	
-	// searching
-	pagesPtr		:= flag.Int	("records",	10,		"Number of records (meta info) in page (max - 50). Example: -records=35")
-	constraintPtr		:= flag.Int	("maxpages",	100,		"Max number of pages to parse. If you want to parse all pages use -1. Example: -maxpages=200")
-	keywordsPtr		:= flag.String	("keywords",	"",		"keywords to search in Springer. Example: -keywords=\"decompilation techniques\"")
-	openAccessPtr		:= flag.Bool	("openaccess",	false,		"Parse only Open Access articles. Example: -openaccess")
-
-	// database & s3
-	tablenamePtr		:= flag.String	("tablename",	"", 		"Table name to upload into. Example: -tablename=\"Music\"")
-	primaryKeyPtr		:= flag.String	("pkname",	"",		"Primary Key name. Example: -pkname=\"Publisher\"")
-	primaryKeyTypePtr	:= flag.String	("pktype",	"",		"Primary Key type. Possible types - \"N\"/\"S\" (Number/String). Example: -pktype=N")
-	sortKeyPtr		:= flag.String	("skname",	"",		"Sort Key name. Example: -skname=\"ID\"")
-	sortKeyTypePtr		:= flag.String	("sktype",	"",		"Sort Key type. Possible types - \"N\"/\"S\" (Number/String). Example: -sktype=N")
-	
-	// credentials
-	accessKeyPtr		:= flag.String	("accesskey",	"",		"Amazon DynamoDB Access Key ID")
-	secretKeyPtr		:= flag.String	("secretkey",	"",		"Amazon DynamoDB Secret Access Key ID")
-	regionPtr		:= flag.String	("region",	"",		"Amazon DynamoDB Region")
-	
-	// S3
-	bucketNamePtr		:= flag.String	("bucketname", 	"",		"S3 bucket name to upload into. Example -bucketname=\"myuniquebucketname3287\"")
-
-	// goroutines
-	routinesPtr		:= flag.Int	("routines",	10,		"Number of routines. Example: -routines=30")
-	timeoutPtr		:= flag.Int	("timeout",	1,		"Timeout duration in seconds (for each routine). Should be at least 1 second. Example: -timeout=5")
-
-	flag.Parse()
-
-
-	if apiKey = *apiKeyPtr; apiKey == "" {
-		fmt.Fprintf(os.Stderr, "Springer API Key is required (Use -h or --help to show available options)\n")
-		os.Exit(1)
-	}
-
-	// keywords flag	
-	if keywords = *keywordsPtr; keywords == "" {
-		fmt.Fprintf(os.Stderr, "Keywords are not specified (Use -h or --help to show available options)\n")
-		os.Exit(1)
-	}
-
-	// if needUpload {
-	tableName, primaryKey, primaryKeyType = *tablenamePtr, *primaryKeyPtr, *primaryKeyTypePtr
-	if !(tableName != "" && primaryKey != "" && (primaryKeyType == "N" || primaryKeyType == "S")) {
-		if tableName == "" {
-			fmt.Fprintf(os.Stderr, "Table name is not specified\n")
-		}
-
-		if primaryKey == "" {
-			fmt.Fprintf(os.Stderr, "primary Key is not specified\n")
-		}
-
-		if primaryKeyType != "N" && primaryKeyType != "S" {
-			fmt.Fprintf(os.Stderr, "Invalid primary key type - \"%s\"\n", primaryKeyType)
-		}
-		os.Exit(1)
-	}
-
-	fmt.Println("Table info:")
-	fmt.Println("\tName:", tableName)
-	fmt.Println("\tPrimary Key:", primaryKey)
-	fmt.Println("\tPrimary Key Type:", primaryKeyType)
-
-	sortKey, sortKeyType = *sortKeyPtr, *sortKeyTypePtr
-	if sortKey != "" && sortKeyType != "" {
-		fmt.Println("\tSort Key:", sortKey)
-		fmt.Println("\tSort Key Type:", sortKeyType)
-	}
-
-	bucketName = *bucketNamePtr
-	if bucketName != "" {
-		needUpload = true
-	}
-
-	// page length flag 
-	pageLength = *pagesPtr
-	
-	if pageLength > 50 {
-		fmt.Fprintf(os.Stderr, "Page length is huge (%s)\n", pageLength)
-		os.Exit(1)
-	}
-	
-	// timeout flag 
-	timeoutDuration = time.Duration(*timeoutPtr)
-	
-	if timeoutDuration < 1 {
-		fmt.Fprintln(os.Stderr, "Invalid timeout value :", int(timeoutDuration))
-		os.Exit(1)
-	}
-
-	// number of routines flag 
-	numWorkers := *routinesPtr
-	if numWorkers < 1 {
-		fmt.Fprintln(os.Stderr, "Invalid routines number :", numWorkers)
-		os.Exit(1)
-	}
-
-	// max pages flag 
-	constraint := *constraintPtr
-	if constraint < -1 {
-		fmt.Fprintf(os.Stderr, "Warning: max number of pages (%d) is less than -1\n", constraint)
-	}
-
-	// connect to database before work
-	var database DataBase
-	var manager S3Manager
-
-	fmt.Println("Connecting to database...")
-
-	var accessKey, secretKey, region string = *accessKeyPtr, *secretKeyPtr, *regionPtr
-	if accessKey == "" || secretKey == "" || region == "" {
-		fmt.Println("Warning! Missing:")
-		if accessKey == "" {
-			fmt.Println("\tAccess Key ID")
-		}
-
-		if secretKey == "" {
-			fmt.Println("\tSecret Key")
-		}
-
-		if region == "" {
-			fmt.Println("\tRegion")
-		}
-
-		if accessKey == "" && secretKey == "" && region == "" {
-			fmt.Println("Trying to find configuration in computer...")
-			err := database.InitAuto()
-			check(err)
-
-			err = manager.InitAuto()
-			check(err)
-			fmt.Println("Found configuration")			
-		} else {
-			os.Exit(1)
-		}
-	} else {
-		err := database.Init(accessKey, secretKey, region)
-		check(err)
-
-		if needUpload {
-			err = manager.Init(accessKey, secretKey, region)
-			check(err)
-		}
-	}
-
-	fmt.Println("Checking table -", tableName)
-	err := database.CreateTableIfNotExists(tableName, primaryKey, primaryKeyType, sortKey, sortKeyType)
-	check(err)
-
-	if needUpload {
-		fmt.Println("Checking bucket -", bucketName)
-		err = manager.CreateBucketIfNotExists(bucketName)
-		check(err)
-	}
-
-	// we need to know how articles number
-	// so get first page with total article count
-
-	// join all strings in slice and process this string
-	// example: ["cyber-physical" "system" "design"] --> "cyber-physical%20system%20design"
-	searchQuery := keywords
-
-	if *openAccessPtr {
-		searchQuery += " openaccess:true"
-	}
-
-	searchQuery = replaceNonLetters(searchQuery)
-
-
-	// form query
-	query := formQuery(1, searchQuery)
-
-	// send request
-	springerResponse, err := http.Get(query)
-	check(err)
-	defer springerResponse.Body.Close()
-
-	// read response
-	xmlfile, err := ioutil.ReadAll(springerResponse.Body)
-	check(err)
-	
-	if xmlfile == nil {
-		log.Fatal("Empty response")
-	}
-
-	// unmarshal xml content
-	var springerInfo SpringerResponse
-
-	check(xml.Unmarshal(xmlfile, &springerInfo))
-
-	// common structure with all metainfo
-
-	fmt.Printf("Found %d records\n", springerInfo.Result.Total)
-
-	// job count
-	numJobs := constraint
-
-	// if there is no constraints or total number of articles less than max number of articles 
-	if numJobs < 0 || springerInfo.Result.Total / pageLength < constraint {
-		numJobs = springerInfo.Result.Total / pageLength
-		
-		// additional records at last page
-		if springerInfo.Result.Total % pageLength != 0 {
-			numJobs++
-		}
-	}
-
-	fmt.Println("Number of pages to parse:", numJobs)
-
-	if numJobs > 0 {
-
-		// urls 
-		jobs		:= make(chan string, numJobs)
-
-		// errors
-		parserErrors	:= make(chan error, numJobs)
-
-		// release workers
-		records := getPages(numWorkers, numJobs, jobs, parserErrors)
-
-		// send jobs
-		go func() {
-			for i := 0; i < numJobs; i++ {
-				jobs <- formQuery((i * pageLength) + 1, searchQuery)
-			}
-			close(jobs)
-		}()
-
-
-		var awsErrors <-chan error
-
-		awsErrors = storeMeta(&database, &manager, numWorkers, numJobs, records)
-
-		// ---STOP HERE UNTIL ALL PARSER GOROUTINES FINISHED---
-		// show parser errors
-		var recievedParserErrors, receivedAWSErrors []error
-		for i := 0; i < numJobs; i++ {
-			if err := <- parserErrors; err != nil {
-				recievedParserErrors = append(recievedParserErrors, err)
-			}
-		}
-
-		if recievedParserErrors != nil {
-			fmt.Println("\n", len(recievedParserErrors), " parser errors:")
-			for _, err := range recievedParserErrors {
-				fmt.Println(err)
-			}
-			fmt.Println()
-		} else {
-			fmt.Println("\nNo parser errors encountered\n")
-		}
-
-		// ---STOP HERE UNTIL ALL AWS GOROUTINES FINISHED---
-		// show aws errors
-		for i := 0; i < recordCounter; i++ {
-			if err := <- awsErrors; err != nil {
-				receivedAWSErrors = append(receivedAWSErrors, err)
-			}
-		}
-
-		if receivedAWSErrors != nil {
-			fmt.Println("\n", len(receivedAWSErrors), " AWS errors:")
-			for _, err := range receivedAWSErrors {
-				fmt.Println(err)
-			}
-			fmt.Println()
-		} 
-		fmt.Println("\nItems inserted into database -", itemCounter, "\n")
-
-	} else if springerInfo.Result.Total > 0 {
-		// else we have only 1 page that already parsed 
-		for _, record := range springerInfo.Records {
-			var articleMeta ArticleMetaInfo
-			articleMeta.Convert(record)
-			err = database.PutItem(tableName, articleMeta)
-			check(err)
-		}
-	}
-	fmt.Println("Success! Elapsed -", time.Since(start))
-}
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"unicode"
+	"strings"
+	"errors"
+	"time"
+	"flag"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+)
+
+func check(err error) {
+	if err != nil {
+		// requests sent so far still count against the quota of the next run
+		springerLimiter.Close()
+		log.Fatal(err)
+	}
+}
+
+const springerAPIdomain	= "http://api.springernature.com/"
+var apiKey string
+
+
+
+// "@sample string/hello !!!\u32a7" -> "sample_string_hello"
+func MakeStringPretty(source string) (result string) {
+	// source = removeForbiddenChars(source)
+	for _, rune := range source {
+		if (unicode.IsLetter(rune) || unicode.IsDigit(rune)) {
+			result += string(rune)
+		} else if unicode.IsSpace(rune) || rune == '\\' || rune == '/' {
+			result += "_"
+		} else {
+			result += ""
+		}
+	}
+
+	// " _sample_string_hello__" -> "sample_string_hello" 
+	result = strings.Trim(result, " _")
+	return
+}
+
+type SpringerResult struct {
+	Total            int `xml:"total"`
+	Start            int `xml:"start"`
+	PageLength       int `xml:"pageLength"`
+	RecordsDisplayed int `xml:"recordsDisplayed"`
+}
+
+type SpringerArticle struct {
+	Title           string  	`xml:"title" json:"title"`
+	Creators        []string	`xml:"creator" json:"authors"`
+	PublicationName string  	`xml:"publicationName" json:"publication_name"`
+	Volume          int     	`xml:"volume" json:"volume"`
+	Number          string  	`xml:"number" json:"number"`
+	OpenAccess	bool		`xml:"openAccess" json:"open_access"`
+	StartingPage    int   		`xml:"startingPage" json:"starting_page"`
+	EndingPage      int   		`xml:"endingPage" json:"ending_page"`
+	Publisher       string		`xml:"publisher" json:"publisher"`
+	PublicationDate string		`xml:"publicationDate" json:"publication_date"`
+	URL             string		`xml:"url" json:"url"`
+	DOI             string		`xml:"doi" json:"doi"`
+	ISBN            string		`xml:"isbn" json:"isbn"`
+	EISBN           string		`xml:"eIsbn" json:"eisbn"`
+	ISSN            string		`xml:"issn" json:"issn"`
+	EISSN           string		`xml:"eIssn" json:"eissn"`
+	JournalID       string		`xml:"journalId" json:"journal_id"`
+	ContentType     string		`xml:"contentType" json:"content_type"`
+	Genre           []string	`xml:"genre" json:"genre"`
+	Subjects        []string	`xml:"subject" json:"subjects"`
+	OnlineDate      string		`xml:"onlineDate" json:"online_date"`
+	PrintDate       string		`xml:"printDate" json:"print_date"`
+	Copyright       string		`xml:"copyright" json:"copyright"`
+	Language        string		`xml:"language" json:"language"`
+}
+
+type SpringerRecord struct {
+	Article  SpringerArticle `xml:"head>article" json:"article_info"`
+	Abstract string          `xml:"body>p" json:"abstract"`
+
+	// query and start offset of the page the record was found on
+	query	*harvestQuery
+	page	int
+
+	// full text article (openaccess/jats API only)
+	jats	[]byte
+}
+
+// DOI from response or from article URL ("http://dx.doi.org/10.1007/xxx" -> "10.1007/xxx")
+func (r SpringerRecord) DOI() string {
+	if r.Article.DOI != "" {
+		return r.Article.DOI
+	}
+	return strings.TrimPrefix(r.Article.URL, "http://dx.doi.org/")
+}
+
+// <facet-value count="10">Computer Science</facet-value>
+type SpringerFacetValue struct {
+	Value string `xml:",chardata" json:"value"`
+	Count int    `xml:"count,attr" json:"count"`
+}
+
+// facet counts of the whole query (subject, keyword, pub, year, country, type)
+type SpringerFacet struct {
+	Name   string               `xml:"name,attr" json:"name"`
+	Values []SpringerFacetValue `xml:"facet-value" json:"values"`
+}
+
+type SpringerResponse struct {
+	XMLName xml.Name         `xml:"response"`
+	Result  SpringerResult   `xml:"result"`
+	Records []SpringerRecord `xml:"records>message" json:"articles"`
+	Facets  []SpringerFacet  `xml:"facets>facet" json:"facets"`
+}
+
+// database respresentation
+type ArticleMetaInfo struct {
+	DOI			string
+	ISBN			string
+	EISBN			string
+	ISSN			string
+	EISSN			string
+	JournalID		string
+	ContentType		string
+	Genre			[]string
+	Subjects		[]string
+	OnlineDate		string
+	PrintDate		string
+	Copyright		string
+	Language		string
+	Authors			[]string
+	Keywords		string
+	KeywordList		[]string	// Keywords as parsed, keywords may contain spaces
+	Title			string
+	Abstract		string
+	PublicationName 	string
+	Number			string
+	PublicationDate 	string
+	Publisher		string
+	Link			string
+	PDFLink			string
+	FileName		string
+	FileSHA256		string	// hex SHA-256 of PDF file
+	FileSize		int64	// size of PDF file in bytes
+	JATSFileName		string
+	OpenAccess		bool
+	AlwaysTheSame		int
+	StartingPage		int   
+	EndingPage		int
+	Volume			int   
+
+	// order of insertion within a run, articles are identified by DOI
+	ID			int
+}
+
+func isPDFAvailable(ctx context.Context, pdfLink string) bool {
+	response, err := pdfClient.Get(ctx, pdfLink)
+	if err != nil {
+		return false
+	}
+	defer response.Body.Close()
+
+	// %PDF
+	pdfSignature := make([]byte, 4)
+	if _, err = io.ReadFull(response.Body, pdfSignature); err != nil {
+		return false
+	}
+	return string(pdfSignature) == "%PDF"
+}
+
+func (a *ArticleMetaInfo) Convert(ctx context.Context, record SpringerRecord, keywords string) {
+	a.DOI = record.DOI()
+	a.ISBN = record.Article.ISBN
+	a.EISBN = record.Article.EISBN
+	a.ISSN = record.Article.ISSN
+	a.EISSN = record.Article.EISSN
+	a.JournalID = record.Article.JournalID
+	a.ContentType = record.Article.ContentType
+	a.Genre = record.Article.Genre
+	a.Subjects = record.Article.Subjects
+	a.OnlineDate = record.Article.OnlineDate
+	a.PrintDate = record.Article.PrintDate
+	a.Copyright = record.Article.Copyright
+	a.Language = record.Article.Language
+	a.Authors = record.Article.Creators
+	a.Title = record.Article.Title
+	a.Abstract = record.Abstract
+	a.PublicationName = record.Article.PublicationName
+	a.Number = record.Article.Number
+	a.PublicationDate = record.Article.PublicationDate
+	a.Publisher = record.Article.Publisher
+	a.Link = record.Article.URL
+	springerKeywords, err := parseKeywords(ctx, a.Link)
+	if err != nil {
+		log.Println("Parsing keywords:", err)
+	}
+	a.Keywords = " "  
+	localKeywords := append([]string{ strings.ToLower(keywords) }, springerKeywords...)
+	a.KeywordList = nil
+	for _, keyword := range localKeywords {
+		a.Keywords += strings.TrimSpace(keyword) + " "
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			a.KeywordList = append(a.KeywordList, keyword)
+		}
+	}
+	a.OpenAccess = record.Article.OpenAccess
+	a.AlwaysTheSame = 1
+	pdfLink := "https://link.springer.com/content/pdf/" + strings.Replace(strings.TrimPrefix(a.Link, "http://dx.doi.org/"), "/", "%2F", -1) + ".pdf"
+	if isPDFAvailable(ctx, pdfLink) {
+		a.PDFLink = pdfLink
+	}
+
+	a.Volume = record.Article.Volume
+	a.StartingPage = record.Article.StartingPage
+	a.EndingPage = record.Article.EndingPage
+}
+
+var pageLength int
+
+var tableName, primaryKey, primaryKeyType, sortKey, sortKeyType string 
+
+func main() {
+	if runCommand() {
+		return
+	}
+
+	start := time.Now()
+
+	// flags
+
+	// springer API
+	apiKeyPtr		:= flag.String	("apikey",	"",		"Spinger API Key")
+	
+	// searching
+	apiPtr			:= flag.String	("api",		"pam",		"Springer API to use. Possible APIs - pam/json/openaccess/jats (full text open access articles). Example: -api=jats")
+	pagesPtr		:= flag.Int	("records",	10,		"Number of records (meta info) in page (max - 50). Example: -records=35")
+	constraintPtr		:= flag.Int	("maxpages",	100,		"Max number of pages to parse. If you want to parse all pages use -1. Example: -maxpages=200")
+	keywordsPtr		:= flag.String	("keywords",	"",		"keywords to search in Springer, can contain AND/OR/NOT. Example: -keywords=\"decompilation techniques\"")
+	queriesPtr		:= flag.String	("queries",	"",		"File with named queries (.yaml) or one query per line (.txt), harvested by the same routines. Example: -queries=\"queries.yaml\"")
+
+	// query constraints, every flag can be repeated
+	var phrases, subjects, years, types, journals, issns, dois, names, countries, languages, excludes listFlag
+	flag.Var(&phrases,	"phrase",	"Exact phrase to search. Example: -phrase=\"binary translation\"")
+	flag.Var(&subjects,	"subject",	"Subject constraint. Example: -subject=\"Computer Science\"")
+	flag.Var(&years,	"year",		"Publication year or range of years. Example: -year=2015-2020")
+	flag.Var(&types,	"type",		"Content type constraint. Possible types - Journal/Book. Example: -type=Journal")
+	flag.Var(&journals,	"journal",	"Journal ID constraint. Example: -journal=10207")
+	flag.Var(&issns,	"issn",		"ISSN constraint. Example: -issn=1861-1117")
+	flag.Var(&dois,		"doi",		"DOI constraint. Example: -doi=\"10.1007/s11276-008-0131-4\"")
+	flag.Var(&names,	"name",		"Author name constraint. Example: -name=\"Salvador Garcia\"")
+	flag.Var(&countries,	"country",	"Country constraint. Example: -country=\"New Zealand\"")
+	flag.Var(&languages,	"language",	"Language constraint. Example: -language=en")
+	flag.Var(&excludes,	"not",		"Exclude records matching constraint. Example: -not=\"type:Book\"")
+	openAccessPtr		:= flag.Bool	("openaccess",	false,		"Parse only Open Access articles. Example: -openaccess")
+	facetsPtr		:= flag.Bool	("facets",	false,		"Only show facet counts (subject, keyword, pub, year, country, type) of the query, without harvesting. Example: -facets")
+	facetsFilePtr		:= flag.String	("facetsfile",	"",		"Save facet counts to .csv or .json file (implies -facets). Example: -facetsfile=\"facets.csv\"")
+
+	// database & s3
+	tablenamePtr		:= flag.String	("tablename",	"", 		"Table name to upload into. Example: -tablename=\"Music\"")
+	primaryKeyPtr		:= flag.String	("pkname",	"DOI",		"Primary Key name. Example: -pkname=\"Publisher\"")
+	primaryKeyTypePtr	:= flag.String	("pktype",	"S",		"Primary Key type. Possible types - \"N\"/\"S\" (Number/String). Example: -pktype=N")
+	sortKeyPtr		:= flag.String	("skname",	"",		"Sort Key name. Example: -skname=\"PublicationDate\"")
+	sortKeyTypePtr		:= flag.String	("sktype",	"",		"Sort Key type. Possible types - \"N\"/\"S\" (Number/String). Example: -sktype=N")
+
+	schemaPtr		:= flag.String	("schema",	"",		"Schema file (.yaml) with global secondary indexes of the table. Example: -schema=\"schema.yaml\"")
+
+	// settings of created table
+	billingPtr		:= flag.String	("billing",	"provisioned",	"Billing mode of created table. Possible modes - provisioned/ondemand. Example: -billing=ondemand")
+	rcuPtr			:= flag.Int64	("rcu",		10,		"Read capacity units of created table (provisioned billing). Example: -rcu=5")
+	wcuPtr			:= flag.Int64	("wcu",		10,		"Write capacity units of created table (provisioned billing). Example: -wcu=25")
+	autoScalingPtr		:= flag.String	("autoscaling",	"",		"Auto scaling of created table capacity - min:max:target utilization (%). Example: -autoscaling=5:100:70")
+	ttlAttributePtr		:= flag.String	("ttlattribute", "",		"Enable TTL on attribute of created table. Example: -ttlattribute=ExpiresAt")
+	ttlDaysPtr		:= flag.Int	("ttldays",	0,		"Items expire after given number of days (requires -ttlattribute), 0 - don't set expiration. Example: -ttldays=90")
+	pitrPtr			:= flag.Bool	("pitr",	false,		"Enable point-in-time recovery of created table. Example: -pitr")
+	var tags listFlag
+	flag.Var(&tags, "tag", "Tag of created table, can be repeated. Example: -tag=project=decompilation")
+	
+	// credentials
+	accessKeyPtr		:= flag.String	("accesskey",	"",		"Amazon DynamoDB Access Key ID")
+	secretKeyPtr		:= flag.String	("secretkey",	"",		"Amazon DynamoDB Secret Access Key ID")
+	regionPtr		:= flag.String	("region",	"",		"Amazon DynamoDB Region")
+	
+	// local storage
+	metaDirPtr		:= flag.String	("metadir",	"",		"Directory to store metadata in instead of DynamoDB. Example: -metadir=\"./meta\"")
+
+	// export
+	var outputs listFlag
+	flag.Var(&outputs, "output", "Export records to file, can be repeated. Possible formats - jsonl/csv/parquet. Example: -output=csv:articles.csv")
+
+	// S3
+	bucketNamePtr		:= flag.String	("bucketname", 	"",		"S3 bucket name to upload into. Example -bucketname=\"myuniquebucketname3287\"")
+	pdfDirPtr		:= flag.String	("pdfdir",	"",		"Directory to save PDF files in instead of S3 bucket. Example: -pdfdir=\"./pdf\"")
+	fileKeysPtr		:= flag.String	("filekeys",	"sha256",	"Names of uploaded files. Possible keys - sha256 (hash of content, identical files are uploaded once)/doi. Example: -filekeys=doi")
+	pdfMaxSizePtr		:= flag.Int64	("pdfmaxsize",	100,		"Max size of PDF file in MB, larger files are not uploaded, 0 - unlimited. Example: -pdfmaxsize=50")
+
+	// checkpoint
+	checkpointPtr		:= flag.String	("checkpoint",	"springerMetaInfo.checkpoint",	"Checkpoint file to save progress in. Example: -checkpoint=\"decompilation.checkpoint\"")
+	resumePtr		:= flag.Bool	("resume",	false,		"Continue previous run from checkpoint file. Example: -resume")
+
+	// goroutines
+	routinesPtr		:= flag.Int	("routines",	10,		"Number of routines of every stage without its own flag. Example: -routines=30")
+	pageRoutinesPtr		:= flag.Int	("pageroutines",	0,	"Number of routines fetching Springer API pages (default -routines). Example: -pageroutines=2")
+	enrichRoutinesPtr	:= flag.Int	("enrichroutines",	0,	"Number of routines parsing article pages (keywords, PDF link) (default -routines). Example: -enrichroutines=20")
+	pdfRoutinesPtr		:= flag.Int	("pdfroutines",	0,		"Number of routines downloading PDF files into S3 bucket or directory (default -routines). Example: -pdfroutines=5")
+	dbRoutinesPtr		:= flag.Int	("dbroutines",	0,		"Number of routines uploading full text files and writing metadata (default -routines). Example: -dbroutines=4")
+	batchSizePtr		:= flag.Int	("batchsize",	25,		"Number of items written to DynamoDB table by one request (1-25), 1 - no batching. Example: -batchsize=10")
+
+	// request budgets, shared by all routines
+	apiRatePtr		:= flag.Float64	("apirate",	2,		"Max Springer API requests per second, 0 - unlimited. Example: -apirate=0.5")
+	apiQuotaPtr		:= flag.Int	("apiquota",	5000,		"Max Springer API requests per day (API key limit), 0 - unlimited. Example: -apiquota=500")
+	landingRatePtr		:= flag.Float64	("landingrate",	5,		"Max article page requests (keywords) per second, 0 - unlimited. Example: -landingrate=2")
+	pdfRatePtr		:= flag.Float64	("pdfrate",	2,		"Max PDF requests per second, 0 - unlimited. Example: -pdfrate=1")
+	retriesPtr		:= flag.Int	("retries",	5,		"Number of retries of failed requests (429, 5xx, timeouts). Example: -retries=10")
+	requestTimeoutPtr	:= flag.Int	("requesttimeout", 60,		"Timeout of one request in seconds, PDF downloads are limited until response headers only. Example: -requesttimeout=120")
+	flag.Int("timeout", 0, "Deprecated, ignored. Requests are limited by -apirate, -landingrate, -pdfrate and -requesttimeout")
+
+	flag.Parse()
+
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "timeout" {
+			fmt.Fprintln(os.Stderr, "Warning: -timeout is deprecated and ignored, use -apirate, -landingrate, -pdfrate and -requesttimeout")
+		}
+	})
+
+
+	if apiKey = *apiKeyPtr; apiKey == "" {
+		fmt.Fprintf(os.Stderr, "Springer API Key is required (Use -h or --help to show available options)\n")
+		os.Exit(1)
+	}
+
+	api, err := NewSpringerAPI(*apiPtr)
+	check(err)
+
+	// requests and uploads are cancelled on second Ctrl-C
+	shutdown := NewShutdown()
+	ctx := shutdown.Context()
+
+	// rate flags
+	if *apiRatePtr < 0 || *landingRatePtr < 0 || *pdfRatePtr < 0 || *apiQuotaPtr < 0 {
+		fmt.Fprintln(os.Stderr, "Request rates and quota can't be negative")
+		os.Exit(1)
+	}
+	springerLimiter = NewRateLimiter("Springer API", *apiRatePtr, *apiQuotaPtr)
+	landingLimiter = NewRateLimiter("article page", *landingRatePtr, 0)
+	pdfLimiter = NewRateLimiter("PDF", *pdfRatePtr, 0)
+
+	// daily quota is shared with previous runs of the same API key
+	quotaPath := filepath.Join(filepath.Dir(*checkpointPtr), "springerMetaInfo.quota")
+	check(springerLimiter.LoadQuota(quotaPath, contentHash([]byte(apiKey))[:16]))
+	if used := springerLimiter.Used(); used > 0 {
+		fmt.Printf("Springer API requests used since %s - %d\n", springerLimiter.WindowStart().Format("2006-01-02 15:04"), used)
+	}
+
+	if *retriesPtr < 0 || *requestTimeoutPtr < 1 {
+		fmt.Fprintln(os.Stderr, "Invalid retries number or request timeout :", *retriesPtr, *requestTimeoutPtr)
+		os.Exit(1)
+	}
+	requestTimeout := time.Duration(*requestTimeoutPtr) * time.Second
+	springerClient = NewHTTPClient(springerLimiter, true, requestTimeout, *retriesPtr)
+	landingClient = NewHTTPClient(landingLimiter, false, requestTimeout, *retriesPtr)
+	pdfClient = NewStreamHTTPClient(pdfLimiter, requestTimeout, *retriesPtr)
+
+	// settings of created table
+	if *billingPtr != "provisioned" && *billingPtr != "ondemand" {
+		fmt.Fprintln(os.Stderr, "Invalid billing mode :", *billingPtr)
+		os.Exit(1)
+	}
+	autoScaling, err := parseAutoScaling(*autoScalingPtr)
+	check(err)
+	tableTags, err := parseTags(tags)
+	check(err)
+	tableOptions := TableOptions{
+		OnDemand:            *billingPtr == "ondemand",
+		ReadCapacity:        *rcuPtr,
+		WriteCapacity:       *wcuPtr,
+		AutoScaling:         autoScaling,
+		TTLAttribute:        *ttlAttributePtr,
+		TTLDays:             *ttlDaysPtr,
+		PointInTimeRecovery: *pitrPtr,
+		Tags:                tableTags,
+	}
+	check(tableOptions.Validate())
+
+	var indexes []IndexSchema
+	if *schemaPtr != "" {
+		indexes, err = loadIndexes(*schemaPtr)
+		check(err)
+	}
+
+	// max pages flag 
+	constraint := *constraintPtr
+	if constraint < -1 {
+		fmt.Fprintf(os.Stderr, "Warning: max number of pages (%d) is less than -1\n", constraint)
+	}
+
+	tableName, primaryKey, primaryKeyType = *tablenamePtr, *primaryKeyPtr, *primaryKeyTypePtr
+	sortKey, sortKeyType = *sortKeyPtr, *sortKeyTypePtr
+
+	bucketName, pdfDir := *bucketNamePtr, *pdfDirPtr
+	if bucketName != "" && pdfDir != "" {
+		fmt.Fprintln(os.Stderr, "Only one of -bucketname and -pdfdir can be specified")
+		os.Exit(1)
+	}
+	if *fileKeysPtr != fileKeysSHA256 && *fileKeysPtr != fileKeysDOI {
+		fmt.Fprintln(os.Stderr, "Invalid file keys :", *fileKeysPtr)
+		os.Exit(1)
+	}
+	if *pdfMaxSizePtr < 0 {
+		fmt.Fprintln(os.Stderr, "Invalid max PDF size :", *pdfMaxSizePtr)
+		os.Exit(1)
+	}
+	files := PipelineFiles{Keys: *fileKeysPtr, MaxPDFSize: *pdfMaxSizePtr << 20}
+
+	// options missing in query file are taken from flags
+	defaults := queryOptions{
+		MaxPages:   constraint,
+		TableName:  tableName,
+		BucketName: bucketName,
+		PDFDir:     pdfDir,
+	}
+
+	var queries []*harvestQuery
+	if *queriesPtr != "" {
+		queries, err = loadQueries(*queriesPtr, defaults, *openAccessPtr)
+		check(err)
+	} else {
+		// keywords and constraints
+		constraints := queryConstraints{
+			Keywords:   *keywordsPtr,
+			Phrases:    phrases,
+			Subjects:   subjects,
+			Years:      years,
+			Types:      types,
+			Journals:   journals,
+			ISSNs:      issns,
+			DOIs:       dois,
+			Names:      names,
+			Countries:  countries,
+			Languages:  languages,
+			Excludes:   excludes,
+			OpenAccess: *openAccessPtr,
+		}
+
+		query, err := constraints.Build()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v (Use -h or --help to show available options)\n", err)
+			os.Exit(1)
+		}
+		queries = []*harvestQuery{{queryOptions: defaults, Name: "query", Keywords: *keywordsPtr, Query: query}}
+	}
+
+	for _, q := range queries {
+		// example: cyber-physical AND year:2020 --> "cyber-physical+AND+year%3A2020"
+		fmt.Printf("Query '%s': %s\n", q.Name, q.Query.String())
+		q.searchQuery = q.Query.Encode()
+	}
+
+	// only show facet counts of the queries, nothing is harvested
+	if *facetsPtr || *facetsFilePtr != "" {
+		if *facetsFilePtr != "" && len(queries) > 1 {
+			fmt.Fprintln(os.Stderr, "-facetsfile can be used only with a single query")
+			os.Exit(1)
+		}
+
+		pageLength = 1
+		for _, q := range queries {
+			springerInfo, err := fetchPage(ctx, api, api.PageURL(q.searchQuery, 1))
+			check(err)
+
+			fmt.Printf("\n%s:\n", q.Name)
+			printFacets(os.Stdout, springerInfo)
+			if *facetsFilePtr != "" {
+				check(writeFacets(*facetsFilePtr, springerInfo.Facets))
+				fmt.Println("\nFacets saved to", *facetsFilePtr)
+			}
+		}
+		check(springerLimiter.Close())
+		return
+	}
+
+	// queries without table are only exported to files (offline mode)
+	var tableNames []string
+	for _, q := range queries {
+		if q.TableName == "" {
+			if len(outputs) == 0 {
+				fmt.Fprintf(os.Stderr, "Table name is not specified (query '%s')\n", q.Name)
+				os.Exit(1)
+			}
+			continue
+		}
+
+		known := false
+		for _, name := range tableNames {
+			known = known || name == q.TableName
+		}
+		if !known {
+			tableNames = append(tableNames, q.TableName)
+		}
+	}
+
+	if len(tableNames) > 0 && !(primaryKey != "" && (primaryKeyType == "N" || primaryKeyType == "S")) {
+		if primaryKey == "" {
+			fmt.Fprintf(os.Stderr, "primary Key is not specified\n")
+		}
+
+		if primaryKeyType != "N" && primaryKeyType != "S" {
+			fmt.Fprintf(os.Stderr, "Invalid primary key type - \"%s\"\n", primaryKeyType)
+		}
+		os.Exit(1)
+	}
+
+	if len(tableNames) > 0 {
+		fmt.Println("Table info:")
+		fmt.Println("\tName:", strings.Join(tableNames, ", "))
+		fmt.Println("\tPrimary Key:", primaryKey)
+		fmt.Println("\tPrimary Key Type:", primaryKeyType)
+
+		if sortKey != "" && sortKeyType != "" {
+			fmt.Println("\tSort Key:", sortKey)
+			fmt.Println("\tSort Key Type:", sortKeyType)
+		}
+	}
+
+	// schema of every table, only names differ
+	tableSchema := TableSchema{
+		PrimaryKey:     primaryKey,
+		PrimaryKeyType: primaryKeyType,
+		SortKey:        sortKey,
+		SortKeyType:    sortKeyType,
+		Indexes:        indexes,
+	}
+	if len(tableNames) > 0 {
+		check(tableSchema.Validate())
+	}
+
+	// page length flag 
+	pageLength = *pagesPtr
+	
+	if pageLength > 50 {
+		fmt.Fprintf(os.Stderr, "Page length is huge (%d)\n", pageLength)
+		os.Exit(1)
+	}
+	
+	if *batchSizePtr < 1 || *batchSizePtr > maxBatchSize {
+		fmt.Fprintf(os.Stderr, "Batch size must be between 1 and %d\n", maxBatchSize)
+		os.Exit(1)
+	}
+
+	// number of routines flag 
+	numWorkers := *routinesPtr
+	if numWorkers < 1 {
+		fmt.Fprintln(os.Stderr, "Invalid routines number :", numWorkers)
+		os.Exit(1)
+	}
+
+	// stages without own flag use -routines
+	stageWorkers := func(flagValue int) int {
+		if flagValue < 0 {
+			fmt.Fprintln(os.Stderr, "Invalid routines number :", flagValue)
+			os.Exit(1)
+		}
+		if flagValue == 0 {
+			return numWorkers
+		}
+		return flagValue
+	}
+
+	workers := PipelineWorkers{
+		Pages:    stageWorkers(*pageRoutinesPtr),
+		Enrich:   stageWorkers(*enrichRoutinesPtr),
+		Download: stageWorkers(*pdfRoutinesPtr),
+		Write:    stageWorkers(*dbRoutinesPtr),
+	}
+
+	// connect to database before work
+	var database DataBase
+	var manager S3Manager
+
+	metaDir := *metaDirPtr
+	var useDynamoDB, useS3 bool
+	for _, q := range queries {
+		useDynamoDB = useDynamoDB || (q.TableName != "" && metaDir == "")
+		useS3 = useS3 || q.BucketName != ""
+	}
+
+	var accessKey, secretKey, region string = *accessKeyPtr, *secretKeyPtr, *regionPtr
+	if !useDynamoDB && !useS3 {
+		if metaDir != "" {
+			fmt.Println("Using local storage -", metaDir)
+		}
+	} else if accessKey == "" || secretKey == "" || region == "" {
+		fmt.Println("Warning! Missing:")
+		if accessKey == "" {
+			fmt.Println("\tAccess Key ID")
+		}
+
+		if secretKey == "" {
+			fmt.Println("\tSecret Key")
+		}
+
+		if region == "" {
+			fmt.Println("\tRegion")
+		}
+
+		if accessKey == "" && secretKey == "" && region == "" {
+			fmt.Println("Trying to find configuration in computer...")
+			if useDynamoDB {
+				fmt.Println("Connecting to database...")
+				err := database.InitAuto()
+				check(err)
+			}
+
+			err := manager.InitAuto()
+			check(err)
+			fmt.Println("Found configuration")			
+		} else {
+			os.Exit(1)
+		}
+	} else {
+		if useDynamoDB {
+			fmt.Println("Connecting to database...")
+			err := database.Init(accessKey, secretKey, region)
+			check(err)
+		}
+
+		if useS3 {
+			err := manager.Init(accessKey, secretKey, region)
+			check(err)
+		}
+	}
+
+	// queries with the same table or bucket share the store
+	stores := make(map[string]MetadataStore)
+	blobStores := make(map[string]BlobStore)
+	for _, q := range queries {
+		if q.TableName != "" {
+			store, ok := stores[q.TableName]
+			if !ok {
+				if metaDir != "" {
+					store = NewFileStore(metaDir)
+				} else {
+					store = &DataBase{svc: database.svc, scaling: database.scaling, options: tableOptions, batchSize: *batchSizePtr}
+				}
+
+				schema := tableSchema
+				schema.Name = q.TableName
+
+				fmt.Println("Checking table -", q.TableName)
+				check(store.EnsureSchema(ctx, schema))
+				stores[q.TableName] = store
+			}
+			q.store = store
+		}
+
+		if q.BucketName != "" {
+			blobs, ok := blobStores["s3:"+q.BucketName]
+			if !ok {
+				bucket := manager
+				fmt.Println("Checking bucket -", q.BucketName)
+				err := bucket.EnsureBucket(ctx, q.BucketName)
+				check(err)
+
+				blobs = &bucket
+				blobStores["s3:"+q.BucketName] = blobs
+			}
+			q.blobs = blobs
+		} else if q.PDFDir != "" {
+			blobs, ok := blobStores["dir:"+q.PDFDir]
+			if !ok {
+				blobs = NewDirBlobStore(q.PDFDir)
+				blobStores["dir:"+q.PDFDir] = blobs
+			}
+			q.blobs = blobs
+		}
+	}
+
+	// records stored by previous run are skipped, so they are kept in the files
+	exports, err := newExportWriters(outputs, *resumePtr)
+	check(err)
+
+	// we need to know how articles number
+	// so get first page of every query with total article count
+	for _, q := range queries {
+		springerInfo, err := fetchPage(ctx, api, api.PageURL(q.searchQuery, 1))
+		check(err)
+
+		q.total = springerInfo.Result.Total
+		fmt.Printf("Query '%s': found %d records\n", q.Name, q.total)
+
+		// page count
+		q.pageCount = q.MaxPages
+
+		// if there is no constraints or total number of articles less than max number of articles 
+		if q.pageCount < 0 || q.total / pageLength < q.MaxPages {
+			q.pageCount = q.total / pageLength
+
+			// additional records at last page
+			if q.total % pageLength != 0 {
+				q.pageCount++
+			}
+		}
+
+		// -maxpages=0 still parses the first page
+		if q.pageCount == 0 && q.total > 0 {
+			q.pageCount = 1
+		}
+
+		fmt.Printf("Query '%s': number of pages to parse: %d\n", q.Name, q.pageCount)
+	}
+
+	// progress journal, page offsets depend on queries, API and page length
+	var fingerprints []string
+	for _, q := range queries {
+		fingerprints = append(fingerprints, q.Name+"="+q.searchQuery)
+	}
+
+	checkpointPath := *checkpointPtr
+	checkpoint, err := OpenCheckpoint(checkpointPath, fmt.Sprintf("%s&p=%d&api=%s", strings.Join(fingerprints, ";"), pageLength, *apiPtr), *resumePtr)
+	check(err)
+
+	if *resumePtr {
+		fmt.Printf("Resuming: %d page(-s) and %d record(-s) already done\n", checkpoint.Pages(), checkpoint.Records())
+	}
+
+	// first Ctrl-C lets routines finish work in progress, second one cancels it
+	interrupts := make(chan os.Signal, 2)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupts
+		fmt.Fprintln(os.Stderr, "\nInterrupted. Finishing pages and records in progress, press Ctrl-C again to cancel them")
+		shutdown.Stop()
+
+		<-interrupts
+		fmt.Fprintln(os.Stderr, "\nCancelling pages and records in progress")
+		shutdown.Abort()
+	}()
+
+	// skip pages finished by previous run
+	var numJobs int
+	for _, q := range queries {
+		for i := 0; i < q.pageCount; i++ {
+			if start := (i * pageLength) + 1; !checkpoint.PageDone(q.pageID(start)) {
+				q.pageStarts = append(q.pageStarts, start)
+			}
+		}
+		numJobs += len(q.pageStarts)
+	}
+
+	var failed, interrupted bool
+	if numJobs > 0 {
+
+		// pages of all queries are fetched by the same workers
+		var jobs []pageJob
+		for _, q := range queries {
+			for _, start := range q.pageStarts {
+				jobs = append(jobs, pageJob{ query: q, start: start, url: api.PageURL(q.searchQuery, start) })
+			}
+		}
+
+		// ---STOP HERE UNTIL ALL PAGES AND RECORDS ARE PROCESSED---
+		fmt.Println("Starting uploading records")
+		pipeline := NewPipeline(ctx, shutdown.Stopped(), api, checkpoint, exports, workers, files)
+		pipeline.Run(jobs)
+
+		// show parser errors
+		recievedParserErrors, receivedAWSErrors := pipeline.pageErrors.Errors(), pipeline.recordErrors.Errors()
+		interruptedPages, interruptedRecords := pipeline.pageErrors.Interrupted(), pipeline.recordErrors.Interrupted()
+
+		if recievedParserErrors != nil {
+			fmt.Println("\n", len(recievedParserErrors), " parser errors:")
+			var quotaExceeded, badAPIKey bool
+			for _, err := range recievedParserErrors {
+				fmt.Println(err)
+				quotaExceeded = quotaExceeded || errors.Is(err, ErrQuotaExceeded)
+				badAPIKey = badAPIKey || errors.Is(err, ErrBadAPIKey)
+			}
+
+			if quotaExceeded {
+				fmt.Println("\nDaily quota of Springer API key is used up, use -resume to fetch remaining pages later")
+			}
+			if badAPIKey {
+				fmt.Println("\nSpringer API key is rejected, check -apikey")
+			}
+			fmt.Println()
+		} else {
+			fmt.Println("\nNo parser errors encountered")
+			fmt.Println()
+		}
+
+		// show aws errors
+		if receivedAWSErrors != nil {
+			fmt.Println("\n", len(receivedAWSErrors), " AWS errors:")
+			for _, err := range receivedAWSErrors {
+				fmt.Println(err)
+			}
+			fmt.Println()
+		} 
+		fmt.Println("\nItems inserted into database -", pipeline.Stored())
+		fmt.Println()
+
+		if interruptedPages > 0 || interruptedRecords > 0 {
+			fmt.Printf("Interrupted: %d page(-s) and %d record(-s) left for the next run\n", interruptedPages, interruptedRecords)
+			fmt.Println()
+		}
+
+		interrupted = isStopped(shutdown.Stopped())
+		failed = recievedParserErrors != nil || receivedAWSErrors != nil || interruptedPages > 0 || interruptedRecords > 0
+	}
+	check(springerLimiter.Close())
+	check(exports.Close())
+	for _, output := range outputs {
+		fmt.Println("Exported -", output)
+	}
+
+	fmt.Printf("Springer API requests since %s - %d\n", springerLimiter.WindowStart().Format("2006-01-02 15:04"), springerLimiter.Used())
+	fmt.Println("Queries:")
+	for _, q := range queries {
+		q.printSummary()
+	}
+
+	// keep journal to retry failed pages and records
+	if failed {
+		check(checkpoint.Close())
+		fmt.Printf("Some pages or records failed or were interrupted. Use -resume to retry them (checkpoint - '%s')\n", checkpointPath)
+	} else {
+		check(checkpoint.Remove())
+	}
+
+	if interrupted {
+		fmt.Println("Interrupted! Elapsed -", time.Since(start))
+		os.Exit(1)
+	}
+
+	fmt.Println("Success! Elapsed -", time.Since(start))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+var pdfSignature = []byte("%PDF")
+
+var errNotPDF = errors.New("Not a PDF")
+
+// Streamed PDF. Signature is checked before anything is uploaded,
+// size is limited and content is hashed while the body is read
+type pdfReader struct {
+	reader  io.Reader
+	maxSize int64 // 0 - unlimited
+	hash    hash.Hash
+	size    int64
+}
+
+func newPDFReader(body io.Reader, maxSize int64) (*pdfReader, error) {
+	signature := make([]byte, len(pdfSignature))
+	if _, err := io.ReadFull(body, signature); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errNotPDF
+		}
+		return nil, err
+	}
+
+	if !bytes.Equal(signature, pdfSignature) {
+		return nil, errNotPDF
+	}
+
+	// signature is a part of the file
+	return &pdfReader{
+		reader:  io.MultiReader(bytes.NewReader(signature), body),
+		maxSize: maxSize,
+		hash:    sha256.New(),
+	}, nil
+}
+
+// Fails when file grows over the limit, so the upload is aborted
+func (r *pdfReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.hash.Write(b[:n])
+	r.size += int64(n)
+
+	if r.maxSize > 0 && r.size > r.maxSize {
+		return n, fmt.Errorf("PDF is larger than %d bytes", r.maxSize)
+	}
+	return n, err
+}
+
+// hex SHA-256 of read content
+func (r *pdfReader) Sum() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
+
+// Key of a file being uploaded before its name is known. Keys with this prefix are left only by interrupted runs,
+// local directory doesn't list them and reconcile command reports them as orphans
+func temporaryKey(extension string) (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return ".upload-" + hex.EncodeToString(random) + extension, nil
+}
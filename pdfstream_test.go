@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestPDFReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    io.Reader
+		maxSize int64
+		content string
+		err     string // error of newPDFReader or reading
+	}{
+		{name: "pdf", body: strings.NewReader("%PDF-1.4 content"), content: "%PDF-1.4 content"},
+		{name: "signature only", body: strings.NewReader("%PDF"), content: "%PDF"},
+		{name: "one byte reads", body: iotest.OneByteReader(strings.NewReader("%PDF-1.7 x")), content: "%PDF-1.7 x"},
+		{name: "html", body: strings.NewReader("<html>login</html>"), err: errNotPDF.Error()},
+		{name: "short", body: strings.NewReader("%PD"), err: errNotPDF.Error()},
+		{name: "empty", body: strings.NewReader(""), err: errNotPDF.Error()},
+		{name: "broken body", body: iotest.TimeoutReader(strings.NewReader("%PDF-1.4")), err: iotest.ErrTimeout.Error()},
+		{name: "size limit", body: strings.NewReader("%PDF-1.4"), maxSize: 8, content: "%PDF-1.4"},
+		{name: "over size limit", body: strings.NewReader("%PDF-1.4 content"), maxSize: 8, err: "PDF is larger than 8 bytes"},
+		{name: "signature over size limit", body: strings.NewReader("%PDF-1.4"), maxSize: 2, err: "PDF is larger than 2 bytes"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pdf, err := newPDFReader(test.body, test.maxSize)
+			var content []byte
+			if err == nil {
+				content, err = ioutil.ReadAll(pdf)
+			}
+
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("error = %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(content) != test.content {
+				t.Errorf("content = %q, want %q", content, test.content)
+			}
+			sum := sha256.Sum256([]byte(test.content))
+			if pdf.Sum() != hex.EncodeToString(sum[:]) {
+				t.Errorf("hash = %s, want hash of content", pdf.Sum())
+			}
+			if pdf.size != int64(len(test.content)) {
+				t.Errorf("size = %d, want %d", pdf.size, len(test.content))
+			}
+		})
+	}
+}
+
+func TestPDFReaderNotPDF(t *testing.T) {
+	// caller distinguishes "not a PDF" from failed download
+	_, err := newPDFReader(bytes.NewReader([]byte("GIF89a")), 0)
+	if !errors.Is(err, errNotPDF) {
+		t.Errorf("error = %v, want errNotPDF", err)
+	}
+}
+
+func TestTemporaryKey(t *testing.T) {
+	first, err := temporaryKey(".pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := temporaryKey(".pdf")
+
+	if !strings.HasPrefix(first, ".upload-") || !strings.HasSuffix(first, ".pdf") {
+		t.Errorf("temporary key = %s", first)
+	}
+	if first == second {
+		t.Errorf("temporary keys are the same: %s", first)
+	}
+}
+
+func TestFileKey(t *testing.T) {
+	tests := []struct {
+		naming, doi, hash, extension string
+		key                          string
+	}{
+		{fileKeysSHA256, "10.1007/s11276-008-0131-4", "ab12", ".pdf", "ab12.pdf"},
+		{fileKeysDOI, "10.1007/s11276-008-0131-4", "ab12", ".pdf", "10.1007%2Fs11276-008-0131-4.pdf"},
+		{fileKeysDOI, "10.1002/(SICI)1097:4<3.0.CO;2-X>", "ab12", ".xml", "10.1002%2F%28SICI%291097%3A4%3C3.0.CO%3B2-X%3E.xml"},
+		{fileKeysDOI, "", "ab12", ".pdf", "ab12.pdf"},
+	}
+
+	for _, test := range tests {
+		if key := fileKey(test.naming, test.doi, test.hash, test.extension); key != test.key {
+			t.Errorf("fileKey(%s, %s) = %s, want %s", test.naming, test.doi, key, test.key)
+		}
+	}
+}
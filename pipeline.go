@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+type pageJob struct {
+	query *harvestQuery
+	start int
+	url   string
+}
+
+// Counters of the whole run, updated atomically
+type pipelineStats struct {
+	pages   int64
+	records int64
+	stored  int64
+
+	// next article ID
+	ids int64
+}
+
+// Errors of one stage, safe for concurrent use. Interrupted pages and records are only counted
+type errorList struct {
+	mutex       sync.Mutex
+	errors      []error
+	interrupted int
+}
+
+func (l *errorList) add(err error) {
+	if err == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err == ErrInterrupted {
+		l.interrupted++
+		return
+	}
+	l.errors = append(l.errors, err)
+}
+
+func (l *errorList) Errors() []error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.errors
+}
+
+func (l *errorList) Interrupted() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.interrupted
+}
+
+// starts numworkers copies of work, Wait returns when all of them return
+func runWorkers(numworkers int, work func()) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	wg.Add(numworkers)
+	for i := 0; i < numworkers; i++ {
+		go func() {
+			defer wg.Done()
+			work()
+		}()
+	}
+	return &wg
+}
+
+// number of workers of every stage
+type PipelineWorkers struct {
+	Pages    int // Springer API paging
+	Enrich   int // article page (keywords) and PDF availability
+	Download int // PDF download, streamed into blob store
+	Write    int // full text upload, metadata store and exports
+}
+
+// naming and limits of uploaded files
+type PipelineFiles struct {
+	Keys       string // fileKeysSHA256 or fileKeysDOI
+	MaxPDFSize int64  // bytes, 0 - unlimited
+}
+
+// Fetches pages and stores their records. Every stage has its own workers and bounded queue,
+// the queue of a stage is closed when all its producers are done,
+// so the stage finishes as soon as its queue is drained.
+// Records without PDF skip download, so slow PDFs don't hold metadata back.
+// After stop is closed no new pages and records are started, ctx cancels work in progress
+type Pipeline struct {
+	ctx  context.Context
+	stop <-chan struct{}
+
+	api        SpringerAPI
+	checkpoint *Checkpoint
+	exports    *exportWriters
+
+	// records found by several queries are stored once
+	seen *recordSet
+
+	workers PipelineWorkers
+	files   PipelineFiles
+
+	stats        pipelineStats
+	pageErrors   errorList
+	recordErrors errorList
+}
+
+func NewPipeline(ctx context.Context, stop <-chan struct{}, api SpringerAPI, checkpoint *Checkpoint, exports *exportWriters, workers PipelineWorkers, files PipelineFiles) *Pipeline {
+	return &Pipeline{
+		ctx:        ctx,
+		stop:       stop,
+		api:        api,
+		checkpoint: checkpoint,
+		exports:    exports,
+		seen:       newRecordSet(),
+		workers:    workers,
+		files:      files,
+	}
+}
+
+// record on its way through the stages
+type pipelineItem struct {
+	query  *harvestQuery
+	record SpringerRecord
+	key    string
+	page   string
+	meta   ArticleMetaInfo
+}
+
+// returns when every page and every record is processed
+func (p *Pipeline) Run(jobs []pageJob) {
+	pages := make(chan pageJob)
+	records := make(chan SpringerRecord, p.workers.Pages*pageLength)
+	downloads := make(chan *pipelineItem, 2*p.workers.Download)
+	writes := make(chan *pipelineItem, 2*p.workers.Write)
+
+	go func() {
+		defer close(pages)
+		for _, j := range jobs {
+			pages <- j
+		}
+	}()
+
+	fetchers := runWorkers(p.workers.Pages, func() { p.fetchPages(pages, records) })
+	enrichers := runWorkers(p.workers.Enrich, func() { p.enrichRecords(records, downloads, writes) })
+	downloaders := runWorkers(p.workers.Download, func() { p.downloadPDFs(downloads, writes) })
+	writers := runWorkers(p.workers.Write, func() { p.writeRecords(writes) })
+
+	// every stage only sends to later stages
+	fetchers.Wait()
+	close(records)
+	enrichers.Wait()
+	close(downloads)
+	downloaders.Wait()
+	close(writes)
+	writers.Wait()
+	p.flushStores(jobs)
+}
+
+// writes items left in batches
+func (p *Pipeline) flushStores(jobs []pageJob) {
+	flushed := make(map[BatchStore]bool)
+	for _, j := range jobs {
+		if store, ok := j.query.store.(BatchStore); ok && !flushed[store] {
+			flushed[store] = true
+			store.Flush(p.ctx)
+		}
+	}
+}
+
+func (p *Pipeline) Pages() int {
+	return int(atomic.LoadInt64(&p.stats.pages))
+}
+
+func (p *Pipeline) Records() int {
+	return int(atomic.LoadInt64(&p.stats.records))
+}
+
+func (p *Pipeline) Stored() int {
+	return int(atomic.LoadInt64(&p.stats.stored))
+}
+
+// Springer API paging
+
+func (p *Pipeline) fetchPages(jobs <-chan pageJob, records chan<- SpringerRecord) {
+	for j := range jobs {
+		p.pageErrors.add(p.fetchPage(j, records))
+	}
+}
+
+func (p *Pipeline) fetchPage(j pageJob, records chan<- SpringerRecord) error {
+	q := j.query
+	if isStopped(p.stop) {
+		return ErrInterrupted
+	}
+
+	page, err := fetchPage(p.ctx, p.api, j.url)
+	if p.ctx.Err() != nil {
+		return ErrInterrupted
+	}
+
+	if err != nil {
+		q.stats.add(func(s *queryStats) { s.errors++ })
+		return err
+	}
+
+	if err = p.checkpoint.PageFetched(q.pageID(j.start), len(page.Records)); err != nil {
+		return err
+	}
+
+	for _, record := range page.Records {
+		record.query = q
+		record.page = j.start
+		records <- record
+	}
+	q.stats.add(func(s *queryStats) {
+		s.pages++
+		s.records += len(page.Records)
+	})
+
+	atomic.AddInt64(&p.stats.records, int64(len(page.Records)))
+	fmt.Printf("Passed: %d page(-s)\n", atomic.AddInt64(&p.stats.pages, 1))
+	return nil
+}
+
+// Enrichment: keywords from article page, PDF link
+
+func (p *Pipeline) enrichRecords(records <-chan SpringerRecord, downloads, writes chan<- *pipelineItem) {
+	for record := range records {
+		item := p.startRecord(record)
+		if item == nil {
+			continue
+		}
+
+		item.meta.Convert(p.ctx, record, item.query.Keywords)
+
+		if item.query.blobs != nil && item.meta.PDFLink != "" {
+			downloads <- item
+		} else {
+			writes <- item
+		}
+	}
+}
+
+// returns nil if record doesn't need to be stored
+func (p *Pipeline) startRecord(record SpringerRecord) *pipelineItem {
+	q := record.query
+	doi, page := record.DOI(), q.pageID(record.page)
+	key := q.recordKey(doi)
+
+	// left for next run, page isn't marked as done
+	if isStopped(p.stop) {
+		q.stats.add(func(s *queryStats) { s.interrupted++ })
+		p.recordErrors.add(ErrInterrupted)
+		return nil
+	}
+
+	// found by another query (or on another page)
+	if doi != "" && !p.seen.Claim(key) {
+		q.stats.add(func(s *queryStats) { s.duplicates++ })
+		p.recordErrors.add(p.checkpoint.RecordStored("", page))
+		return nil
+	}
+
+	// already stored by previous run
+	if p.checkpoint.RecordDone(key) {
+		q.stats.add(func(s *queryStats) { s.skipped++ })
+		p.recordErrors.add(p.checkpoint.RecordStored(key, page))
+		return nil
+	}
+
+	return &pipelineItem{query: q, record: record, key: key, page: page}
+}
+
+// Every started record ends here, stored or failed
+func (p *Pipeline) finish(item *pipelineItem, err error) {
+	q := item.query
+
+	if err != nil {
+		p.seen.Release(item.key)
+		if p.ctx.Err() != nil {
+			q.stats.add(func(s *queryStats) { s.interrupted++ })
+			p.recordErrors.add(ErrInterrupted)
+			return
+		}
+
+		q.stats.add(func(s *queryStats) { s.errors++ })
+		p.recordErrors.add(err)
+		return
+	}
+
+	q.stats.add(func(s *queryStats) { s.stored++ })
+	atomic.AddInt64(&p.stats.stored, 1)
+	p.recordErrors.add(p.checkpoint.RecordStored(item.key, item.page))
+}
+
+// PDF download
+
+func (p *Pipeline) downloadPDFs(downloads <-chan *pipelineItem, writes chan<- *pipelineItem) {
+	for item := range downloads {
+		if err := p.downloadPDF(item); err != nil {
+			p.finish(item, err)
+			continue
+		}
+		writes <- item
+	}
+}
+
+// Streams PDF into blob store, nothing is saved locally. DOI key is known before the download,
+// existing file isn't downloaded again (its hash and size stay unknown).
+// Hash key is known only when the whole file is read, so such file is uploaded under temporary key
+// and then moved, or removed if identical file is already stored
+func (p *Pipeline) downloadPDF(item *pipelineItem) error {
+	blobs := item.query.blobs
+	if hasDOIKey(p.files.Keys, item.meta.DOI) {
+		filename := fileKey(p.files.Keys, item.meta.DOI, "", ".pdf")
+		exists, err := blobs.Exists(p.ctx, filename)
+		if err != nil {
+			return err
+		}
+		if exists {
+			fmt.Println("Already uploaded -", filename)
+			item.meta.FileName = filename
+			return nil
+		}
+	}
+
+	response, err := pdfClient.Get(p.ctx, item.meta.PDFLink)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if p.files.MaxPDFSize > 0 && response.ContentLength > p.files.MaxPDFSize {
+		return fmt.Errorf("PDF is larger than %d bytes - %s", p.files.MaxPDFSize, item.meta.PDFLink)
+	}
+
+	pdf, err := newPDFReader(response.Body, p.files.MaxPDFSize)
+	if err == errNotPDF {
+		return errors.New(fmt.Sprint("Not a PDF - ", item.meta.PDFLink))
+	}
+	if err != nil {
+		return err
+	}
+
+	if hasDOIKey(p.files.Keys, item.meta.DOI) {
+		filename := fileKey(p.files.Keys, item.meta.DOI, "", ".pdf")
+		fmt.Println("Uploading -", filename)
+
+		if err = blobs.Put(p.ctx, filename, pdf); err != nil {
+			return fmt.Errorf("%v - %s", err, item.meta.PDFLink)
+		}
+		item.meta.FileName = filename
+	} else {
+		tmpKey, err := temporaryKey(".pdf")
+		if err != nil {
+			return err
+		}
+		fmt.Println("Uploading -", item.meta.PDFLink)
+
+		if err = blobs.Put(p.ctx, tmpKey, pdf); err != nil {
+			return fmt.Errorf("%v - %s", err, item.meta.PDFLink)
+		}
+
+		filename := fileKey(p.files.Keys, item.meta.DOI, pdf.Sum(), ".pdf")
+		if err = p.storeUploaded(blobs, tmpKey, filename); err != nil {
+			// left after cancellation, reported as orphan by reconcile command
+			blobs.Delete(p.ctx, tmpKey)
+			return err
+		}
+		item.meta.FileName = filename
+	}
+
+	item.meta.FileSHA256, item.meta.FileSize = pdf.Sum(), pdf.size
+	return nil
+}
+
+// moves uploaded file to its key
+func (p *Pipeline) storeUploaded(blobs BlobStore, tmpKey, filename string) error {
+	exists, err := blobs.Exists(p.ctx, filename)
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Println("Already uploaded -", filename)
+		return blobs.Delete(p.ctx, tmpKey)
+	}
+
+	fmt.Println("Uploaded -", filename)
+	return blobs.Move(p.ctx, tmpKey, filename)
+}
+
+// Full text upload
+
+// full text is saved next to PDFs
+func (p *Pipeline) upload(item *pipelineItem) error {
+	filename := fileKey(p.files.Keys, item.meta.DOI, contentHash(item.record.jats), ".xml")
+	if err := p.uploadOnce(item.query.blobs, filename, bytes.NewReader(item.record.jats)); err != nil {
+		return err
+	}
+	item.meta.JATSFileName = filename
+	return nil
+}
+
+// Existing file is kept, the same key means the same content (or the same article)
+func (p *Pipeline) uploadOnce(blobs BlobStore, filename string, body io.Reader) error {
+	exists, err := blobs.Exists(p.ctx, filename)
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Println("Already uploaded -", filename)
+		return nil
+	}
+
+	fmt.Println("Uploading -", filename)
+	return blobs.Put(p.ctx, filename, body)
+}
+
+// Exports and metadata store
+
+func (p *Pipeline) writeRecords(writes <-chan *pipelineItem) {
+	for item := range writes {
+		p.write(item)
+	}
+}
+
+// finishes item when it is written, batched items are finished by their batch.
+// Full text is already in memory, so it is uploaded here instead of by own stage
+func (p *Pipeline) write(item *pipelineItem) {
+	if item.query.blobs != nil && item.record.jats != nil {
+		if err := p.upload(item); err != nil {
+			p.finish(item, err)
+			return
+		}
+	}
+
+	item.meta.ID = int(atomic.AddInt64(&p.stats.ids, 1) - 1)
+
+	store := item.query.store
+	if store == nil {
+		p.stored(item, nil)
+		return
+	}
+
+	fmt.Printf("Inserting '%s' into '%s'\n", item.meta.Title, item.query.TableName)
+	if batchStore, ok := store.(BatchStore); ok {
+		batchStore.PutAsync(p.ctx, item.meta, func(err error) { p.stored(item, err) })
+		return
+	}
+	p.stored(item, store.Put(p.ctx, item.meta))
+}
+
+// Record is exported only when it is stored, so a failed record isn't exported again by the next run.
+// Exported once, even if queries store the record into different tables
+func (p *Pipeline) stored(item *pipelineItem, err error) {
+	if err == nil && (item.meta.DOI == "" || p.seen.Claim("|export|"+item.meta.DOI)) {
+		err = p.exports.Write(item.meta)
+	}
+	p.finish(item, err)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Springer API answering pages by "<search query>/<start>", records are taken from pages
+type fakeSpringerAPI struct {
+	server string
+	pages  map[string][]string // DOIs of every page
+}
+
+func (api *fakeSpringerAPI) PageURL(searchQuery string, start int) string {
+	return api.server + "/api/" + searchQuery + "/" + strconv.Itoa(start)
+}
+
+func (api *fakeSpringerAPI) Parse(body []byte) (*SpringerResponse, error) {
+	response := &SpringerResponse{}
+	for _, doi := range api.pages[string(body)] {
+		response.Records = append(response.Records, SpringerRecord{Article: SpringerArticle{
+			DOI:   doi,
+			Title: "Article " + doi,
+			URL:   api.server + "/article/" + doi,
+		}})
+	}
+	return response, nil
+}
+
+// sends requests of every host to the test server
+type testTransport struct {
+	server *httptest.Server
+}
+
+func (t testTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	request.URL.Scheme, request.URL.Host = "http", t.server.Listener.Addr().String()
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+// Springer API pages, empty article pages (no keywords), PDFs are not found
+func newFakeSpringer(t *testing.T, pages map[string][]string) SpringerAPI {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/"):
+			w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/api/")))
+		case strings.HasPrefix(r.URL.Path, "/article/"):
+			w.Write([]byte("<html><body></body></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	saved := []*HTTPClient{springerClient, landingClient, pdfClient}
+	t.Cleanup(func() { springerClient, landingClient, pdfClient = saved[0], saved[1], saved[2] })
+
+	newClient := func() *HTTPClient {
+		client := NewHTTPClient(nil, false, 5*time.Second, 0)
+		client.client.Transport = testTransport{server}
+		return client
+	}
+	springerClient, landingClient, pdfClient = newClient(), newClient(), newClient()
+
+	return &fakeSpringerAPI{server: server.URL, pages: pages}
+}
+
+func TestPipelineDeduplication(t *testing.T) {
+	api := newFakeSpringer(t, map[string][]string{
+		"first/1":  {"10.1/1", "10.1/2"},
+		"first/3":  {"10.1/2"}, // moved to the next page while paging
+		"second/1": {"10.1/1", "10.1/3"},
+		"other/1":  {"10.1/1"},
+	})
+
+	dir := newTestDir(t)
+	newStore := func(tablename string) MetadataStore {
+		store := NewFileStore(dir)
+		schema := testSchema
+		schema.Name = tablename
+		if err := store.EnsureSchema(context.Background(), schema); err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+	articles, other := newStore("Articles"), newStore("Other")
+
+	queries := []*harvestQuery{
+		{Name: "first", queryOptions: queryOptions{TableName: "Articles"}, searchQuery: "first", store: articles},
+		{Name: "second", queryOptions: queryOptions{TableName: "Articles"}, searchQuery: "second", store: articles},
+		{Name: "other", queryOptions: queryOptions{TableName: "Other"}, searchQuery: "other", store: other},
+	}
+	var jobs []pageJob
+	for _, q := range queries {
+		for _, start := range []int{1, 3} {
+			jobs = append(jobs, pageJob{query: q, start: start, url: api.PageURL(q.searchQuery, start)})
+		}
+	}
+
+	run := func(resume bool) (*Pipeline, []exportedRecord) {
+		checkpoint, err := OpenCheckpoint(filepath.Join(dir, "test.checkpoint"), testQuery, resume)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer checkpoint.Close()
+
+		exportPath := filepath.Join(dir, "articles.jsonl")
+		exports, err := newExportWriters([]string{"jsonl:" + exportPath}, resume)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		workers := PipelineWorkers{Pages: 2, Enrich: 3, Download: 1, Write: 2}
+		pipeline := NewPipeline(context.Background(), make(chan struct{}), api, checkpoint, exports, workers, PipelineFiles{})
+		pipeline.Run(jobs)
+
+		if err = exports.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if errs := append(pipeline.pageErrors.Errors(), pipeline.recordErrors.Errors()...); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		return pipeline, readJSONL(t, exportPath)
+	}
+
+	pipeline, exported := run(false)
+	if pipeline.Records() != 6 || pipeline.Stored() != 4 {
+		t.Errorf("%d records, %d stored, want 6 and 4", pipeline.Records(), pipeline.Stored())
+	}
+
+	// stored once per table, exported once
+	stored := func(store MetadataStore) (dois []string) {
+		items, err := store.List(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range items {
+			dois = append(dois, item.DOI)
+		}
+		sort.Strings(dois)
+		return dois
+	}
+	if dois := stored(articles); !reflect.DeepEqual(dois, []string{"10.1/1", "10.1/2", "10.1/3"}) {
+		t.Errorf("Articles = %v", dois)
+	}
+	if dois := stored(other); !reflect.DeepEqual(dois, []string{"10.1/1"}) {
+		t.Errorf("Other = %v", dois)
+	}
+
+	var exportedDOIs []string
+	for _, record := range exported {
+		exportedDOIs = append(exportedDOIs, record.DOI)
+	}
+	sort.Strings(exportedDOIs)
+	if !reflect.DeepEqual(exportedDOIs, []string{"10.1/1", "10.1/2", "10.1/3"}) {
+		t.Errorf("exported %v", exportedDOIs)
+	}
+
+	duplicates := 0
+	for _, q := range queries {
+		duplicates += q.stats.duplicates
+	}
+	if duplicates != 2 {
+		t.Errorf("%d duplicates, want 2", duplicates)
+	}
+
+	// resumed run skips everything stored, export file is kept
+	for _, q := range queries {
+		q.stats = queryStats{}
+	}
+	pipeline, exported = run(true)
+	if pipeline.Stored() != 0 || len(exported) != 3 {
+		t.Errorf("resumed run stored %d and exported %d records, want 0 and 3", pipeline.Stored(), len(exported))
+	}
+	skipped := 0
+	for _, q := range queries {
+		skipped += q.stats.skipped
+	}
+	if skipped != 4 {
+		t.Errorf("%d skipped, want 4", skipped)
+	}
+}
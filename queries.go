@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// per-query options, default values come from flags
+type queryOptions struct {
+	MaxPages   int
+	TableName  string
+	BucketName string
+	PDFDir     string
+}
+
+// One query of the run. All queries are harvested by the same workers
+type harvestQuery struct {
+	queryOptions
+	Name     string
+	Keywords string
+	Query    QueryBuilder
+
+	// escaped query
+	searchQuery string
+
+	// targets, nil if not used
+	store MetadataStore
+	blobs BlobStore
+
+	total      int
+	pageCount  int
+	pageStarts []int // pages left to fetch
+	stats      queryStats
+}
+
+// checkpoint id of the page
+func (q *harvestQuery) pageID(start int) string {
+	return q.Name + ":" + strconv.Itoa(start)
+}
+
+// records with the same DOI found by several queries are stored once per table
+func (q *harvestQuery) recordKey(doi string) string {
+	return q.TableName + "|" + doi
+}
+
+type queryStats struct {
+	mutex       sync.Mutex
+	pages       int
+	records     int
+	stored      int
+	skipped     int // stored by previous run
+	duplicates  int // found by another query
+	errors      int
+	interrupted int // left for next run
+}
+
+func (s *queryStats) add(update func(s *queryStats)) {
+	s.mutex.Lock()
+	update(s)
+	s.mutex.Unlock()
+}
+
+func (q *harvestQuery) printSummary() {
+	q.stats.mutex.Lock()
+	defer q.stats.mutex.Unlock()
+
+	fmt.Printf("\t%s: found %d, pages %d/%d, records %d, stored %d, skipped %d, duplicates %d, errors %d",
+		q.Name, q.total, q.stats.pages, len(q.pageStarts), q.stats.records,
+		q.stats.stored, q.stats.skipped, q.stats.duplicates, q.stats.errors)
+	if q.stats.interrupted > 0 {
+		fmt.Printf(", interrupted %d", q.stats.interrupted)
+	}
+	fmt.Println()
+}
+
+// Set of records (by key) that are stored or being stored by some worker
+type recordSet struct {
+	mutex sync.Mutex
+	keys  map[string]bool
+}
+
+func newRecordSet() *recordSet {
+	return &recordSet{keys: make(map[string]bool)}
+}
+
+// returns false if key is already claimed
+func (s *recordSet) Claim(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.keys[key] {
+		return false
+	}
+	s.keys[key] = true
+	return true
+}
+
+// lets another query store the record after failure
+func (s *recordSet) Release(key string) {
+	s.mutex.Lock()
+	delete(s.keys, key)
+	s.mutex.Unlock()
+}
+
+// string or list of strings
+type yamlList []string
+
+func (l *yamlList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*l = list
+		return nil
+	}
+
+	var single string
+	if err := unmarshal(&single); err != nil {
+		return err
+	}
+	*l = yamlList{single}
+	return nil
+}
+
+// Query file (.yaml):
+//
+// queries:
+//   - name: decompilation
+//     keywords: decompilation
+//     subject: Computer Science
+//     year: 2015-2020
+//     openaccess: true
+//     maxpages: 10
+//     tablename: Decompilation
+//     bucketname: decompilation-pdf
+type queryFileEntry struct {
+	Name       string   `yaml:"name"`
+	Keywords   string   `yaml:"keywords"`
+	Phrase     yamlList `yaml:"phrase"`
+	Subject    yamlList `yaml:"subject"`
+	Year       yamlList `yaml:"year"`
+	Type       yamlList `yaml:"type"`
+	Journal    yamlList `yaml:"journal"`
+	ISSN       yamlList `yaml:"issn"`
+	DOI        yamlList `yaml:"doi"`
+	Author     yamlList `yaml:"author"`
+	Country    yamlList `yaml:"country"`
+	Language   yamlList `yaml:"language"`
+	Not        yamlList `yaml:"not"`
+	OpenAccess *bool    `yaml:"openaccess"`
+	MaxPages   *int     `yaml:"maxpages"`
+	TableName  string   `yaml:"tablename"`
+	BucketName string   `yaml:"bucketname"`
+	PDFDir     string   `yaml:"pdfdir"`
+}
+
+type queryFile struct {
+	Queries []queryFileEntry `yaml:"queries"`
+}
+
+// Loads queries from .yaml/.yml file or from text file with one query
+// (keywords and constraints in Springer syntax) per line.
+// Options missing in the file are taken from defaults
+func loadQueries(path string, defaults queryOptions, openAccess bool) (queries []*harvestQuery, err error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		queries, err = loadYAMLQueries(path, defaults, openAccess)
+	default:
+		queries, err = loadTextQueries(path, defaults, openAccess)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("No queries found in '%s'", path)
+	}
+
+	names := make(map[string]bool)
+	for _, q := range queries {
+		if names[q.Name] {
+			return nil, fmt.Errorf("Duplicate query name '%s' in '%s'", q.Name, path)
+		}
+		names[q.Name] = true
+	}
+	return
+}
+
+func loadYAMLQueries(path string, defaults queryOptions, openAccess bool) (queries []*harvestQuery, err error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file queryFile
+	if err = yaml.UnmarshalStrict(content, &file); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	for i, entry := range file.Queries {
+		q := &harvestQuery{
+			queryOptions: defaults,
+			Name:         entry.Name,
+			Keywords:     entry.Keywords,
+		}
+		if q.Name == "" {
+			q.Name = "query-" + strconv.Itoa(i+1)
+		}
+		if entry.MaxPages != nil {
+			q.MaxPages = *entry.MaxPages
+		}
+		if entry.TableName != "" {
+			q.TableName = entry.TableName
+		}
+
+		// target bucket or directory replaces the default one
+		if entry.BucketName != "" || entry.PDFDir != "" {
+			q.BucketName, q.PDFDir = entry.BucketName, entry.PDFDir
+		}
+
+		constraints := queryConstraints{
+			Keywords:   entry.Keywords,
+			Phrases:    entry.Phrase,
+			Subjects:   entry.Subject,
+			Years:      entry.Year,
+			Types:      entry.Type,
+			Journals:   entry.Journal,
+			ISSNs:      entry.ISSN,
+			DOIs:       entry.DOI,
+			Names:      entry.Author,
+			Countries:  entry.Country,
+			Languages:  entry.Language,
+			Excludes:   entry.Not,
+			OpenAccess: openAccess,
+		}
+		if entry.OpenAccess != nil {
+			constraints.OpenAccess = *entry.OpenAccess
+		}
+
+		if q.Query, err = constraints.Build(); err != nil {
+			return nil, fmt.Errorf("Query '%s': %v", q.Name, err)
+		}
+		queries = append(queries, q)
+	}
+	return
+}
+
+// empty lines and lines starting with '#' are skipped
+func loadTextQueries(path string, defaults queryOptions, openAccess bool) (queries []*harvestQuery, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		q := &harvestQuery{
+			queryOptions: defaults,
+			Name:         "query-" + strconv.Itoa(line),
+			Keywords:     text,
+		}
+
+		constraints := queryConstraints{Keywords: text, OpenAccess: openAccess}
+		if q.Query, err = constraints.Build(); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		queries = append(queries, q)
+	}
+	return queries, scanner.Err()
+}
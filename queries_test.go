@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRecordSet(t *testing.T) {
+	set := newRecordSet()
+	if !set.Claim("Articles|10.1/1") {
+		t.Fatal("first claim failed")
+	}
+	if set.Claim("Articles|10.1/1") {
+		t.Error("key is claimed twice")
+	}
+	if !set.Claim("Other|10.1/1") {
+		t.Error("key of other table is claimed")
+	}
+
+	// failed record can be stored by another query
+	set.Release("Articles|10.1/1")
+	if !set.Claim("Articles|10.1/1") {
+		t.Error("released key can't be claimed")
+	}
+}
+
+func TestRecordSetConcurrentClaims(t *testing.T) {
+	set := newRecordSet()
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	claimed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if set.Claim("Articles|10.1/1") {
+				mutex.Lock()
+				claimed++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if claimed != 1 {
+		t.Errorf("key is claimed %d times, want once", claimed)
+	}
+}
+
+func writeQueryFile(t *testing.T, name, content string) string {
+	path := filepath.Join(newTestDir(t), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var testQueryDefaults = queryOptions{MaxPages: 5, TableName: "Default", BucketName: "default-bucket"}
+
+func TestLoadYAMLQueries(t *testing.T) {
+	path := writeQueryFile(t, "queries.yaml", `
+queries:
+  - name: decompilation
+    keywords: decompilation OR disassembly
+    subject: Computer Science
+    year: [2019, 2020]
+    maxpages: 2
+    tablename: Decompilation
+    pdfdir: ./pdf
+  - keywords: obfuscation
+    openaccess: false
+`)
+
+	queries, err := loadQueries(path, testQueryDefaults, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("%d queries, want 2", len(queries))
+	}
+
+	tests := []struct {
+		q       *harvestQuery
+		name    string
+		options queryOptions
+		query   string
+	}{
+		{
+			queries[0], "decompilation",
+			// directory replaces the default bucket
+			queryOptions{MaxPages: 2, TableName: "Decompilation", PDFDir: "./pdf"},
+			`(decompilation OR disassembly) AND subject:"Computer Science" AND (year:2019 OR year:2020) AND openaccess:true`,
+		},
+		{queries[1], "query-2", testQueryDefaults, "obfuscation"},
+	}
+
+	for _, test := range tests {
+		if test.q.Name != test.name {
+			t.Errorf("name = %s, want %s", test.q.Name, test.name)
+		}
+		if test.q.queryOptions != test.options {
+			t.Errorf("%s: options = %+v, want %+v", test.name, test.q.queryOptions, test.options)
+		}
+		if query := test.q.Query.String(); query != test.query {
+			t.Errorf("%s: query = %s, want %s", test.name, query, test.query)
+		}
+	}
+}
+
+func TestLoadTextQueries(t *testing.T) {
+	path := writeQueryFile(t, "queries.txt", "# harvested weekly\ndecompilation\n\n  binary AND subject:Engineering  \n")
+
+	queries, err := loadQueries(path, testQueryDefaults, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ name, keywords string }{
+		{"query-2", "decompilation"},
+		{"query-4", "binary AND subject:Engineering"},
+	}
+	if len(queries) != len(want) {
+		t.Fatalf("%d queries, want %d", len(queries), len(want))
+	}
+	for i, q := range queries {
+		if q.Name != want[i].name || q.Keywords != want[i].keywords || q.queryOptions != testQueryDefaults {
+			t.Errorf("query %d = %s %q %+v, want %s %q", i, q.Name, q.Keywords, q.queryOptions, want[i].name, want[i].keywords)
+		}
+	}
+}
+
+func TestLoadQueriesErrors(t *testing.T) {
+	tests := []struct {
+		name, file, content string
+	}{
+		{"empty text file", "queries.txt", "# nothing yet\n\n"},
+		{"no queries", "queries.yaml", "queries: []\n"},
+		{"duplicate names", "queries.yml", "queries:\n  - name: a\n    keywords: x\n  - name: a\n    keywords: y\n"},
+		{"unknown option", "queries.yaml", "queries:\n  - keywords: x\n    subjects: Engineering\n"},
+		{"invalid year", "queries.yaml", "queries:\n  - keywords: x\n    year: recent\n"},
+		{"nothing to search", "queries.yaml", "queries:\n  - name: empty\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := loadQueries(writeQueryFile(t, test.file, test.content), testQueryDefaults, false); err == nil {
+				t.Error("error expected")
+			}
+		})
+	}
+
+	if _, err := loadQueries(filepath.Join(newTestDir(t), "missing.yaml"), testQueryDefaults, false); err == nil {
+		t.Error("missing file: error expected")
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// flag that can be repeated: -subject=A -subject=B
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Builds Springer query from keywords, phrases and constraints.
+// Terms are joined by AND, values of one constraint by OR.
+// Example: decompilation AND (subject:"Computer Science" OR subject:Engineering) AND NOT type:Book
+type QueryBuilder struct {
+	terms []string
+}
+
+// "Computer Science" -> "\"Computer Science\"", Engineering -> Engineering
+func quoteValue(value string) string {
+	value = strings.TrimSpace(value)
+	if strings.ContainsAny(value, " \t()") && !strings.HasPrefix(value, "\"") {
+		return "\"" + strings.Replace(value, "\"", "", -1) + "\""
+	}
+	return value
+}
+
+// free text, can contain AND/OR/NOT and "phrases"
+func (b *QueryBuilder) Keywords(text string) *QueryBuilder {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return b
+	}
+	if strings.Contains(text, " OR ") {
+		text = "(" + text + ")"
+	}
+	b.terms = append(b.terms, text)
+	return b
+}
+
+// exact phrase
+func (b *QueryBuilder) Phrase(text string) *QueryBuilder {
+	text = strings.TrimSpace(strings.Replace(text, "\"", "", -1))
+	if text != "" {
+		b.terms = append(b.terms, "\""+text+"\"")
+	}
+	return b
+}
+
+// name:value
+func (b *QueryBuilder) Constraint(name, value string) *QueryBuilder {
+	return b.AnyOf(name, []string{value})
+}
+
+// (name:value1 OR name:value2 ...)
+func (b *QueryBuilder) AnyOf(name string, values []string) *QueryBuilder {
+	var parts []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			parts = append(parts, name+":"+quoteValue(value))
+		}
+	}
+
+	switch len(parts) {
+	case 0:
+	case 1:
+		b.terms = append(b.terms, parts[0])
+	default:
+		b.terms = append(b.terms, "("+strings.Join(parts, " OR ")+")")
+	}
+	return b
+}
+
+// NOT name:value
+func (b *QueryBuilder) Not(name, value string) *QueryBuilder {
+	if value = strings.TrimSpace(value); value != "" {
+		b.terms = append(b.terms, "NOT "+name+":"+quoteValue(value))
+	}
+	return b
+}
+
+func (b *QueryBuilder) Empty() bool {
+	return len(b.terms) == 0
+}
+
+// query as it is sent to Springer (not escaped)
+func (b *QueryBuilder) String() string {
+	return strings.Join(b.terms, " AND ")
+}
+
+// query escaped for URL
+func (b *QueryBuilder) Encode() string {
+	return url.QueryEscape(b.String())
+}
+
+// keywords and constraints of one query, from flags or query file
+type queryConstraints struct {
+	Keywords   string
+	Phrases    []string
+	Subjects   []string
+	Years      []string
+	Types      []string
+	Journals   []string
+	ISSNs      []string
+	DOIs       []string
+	Names      []string
+	Countries  []string
+	Languages  []string
+	Excludes   []string
+	OpenAccess bool
+}
+
+func (c queryConstraints) Build() (query QueryBuilder, err error) {
+	query.Keywords(c.Keywords)
+	for _, phrase := range c.Phrases {
+		query.Phrase(phrase)
+	}
+
+	query.AnyOf("subject", c.Subjects)
+
+	var yearList []string
+	for _, yearRange := range c.Years {
+		rangeYears, err := parseYears(yearRange)
+		if err != nil {
+			return query, err
+		}
+		yearList = append(yearList, rangeYears...)
+	}
+	query.AnyOf("year", yearList)
+
+	query.AnyOf("type", c.Types)
+	query.AnyOf("journal", c.Journals)
+	query.AnyOf("issn", c.ISSNs)
+	query.AnyOf("doi", c.DOIs)
+	query.AnyOf("name", c.Names)
+	query.AnyOf("country", c.Countries)
+	query.AnyOf("language", c.Languages)
+
+	for _, exclude := range c.Excludes {
+		name, value, err := parseConstraint(exclude)
+		if err != nil {
+			return query, err
+		}
+		query.Not(name, value)
+	}
+
+	if c.OpenAccess {
+		query.Constraint("openaccess", "true")
+	}
+
+	if query.Empty() {
+		err = errors.New("Keywords or constraints are not specified")
+	}
+	return
+}
+
+// "2015-2020" -> ["2015" ... "2020"]; "2018" -> ["2018"]
+func parseYears(value string) (years []string, err error) {
+	parts := strings.SplitN(value, "-", 2)
+	from, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid year '%s'", value)
+	}
+
+	to := from
+	if len(parts) == 2 {
+		if to, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+			return nil, fmt.Errorf("Invalid year range '%s'", value)
+		}
+	}
+
+	if to < from || to-from > 100 {
+		return nil, fmt.Errorf("Invalid year range '%s'", value)
+	}
+
+	for year := from; year <= to; year++ {
+		years = append(years, strconv.Itoa(year))
+	}
+	return
+}
+
+// "subject:Mathematics" -> "subject", "Mathematics"
+func parseConstraint(value string) (name, constraintValue string, err error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("Invalid constraint '%s'. Should be 'name:value'", value)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuoteValue(t *testing.T) {
+	tests := []struct {
+		value, quoted string
+	}{
+		{"Engineering", "Engineering"},
+		{" Engineering ", "Engineering"},
+		{"Computer Science", `"Computer Science"`},
+		{"New\tZealand", "\"New\tZealand\""},
+		{"C(++)", `"C(++)"`},
+		{`say "hi" now`, `"say hi now"`},
+		{`"already quoted"`, `"already quoted"`},
+	}
+
+	for _, test := range tests {
+		if quoted := quoteValue(test.value); quoted != test.quoted {
+			t.Errorf("quoteValue(%q) = %q, want %q", test.value, quoted, test.quoted)
+		}
+	}
+}
+
+func TestQueryConstraintsBuild(t *testing.T) {
+	tests := []struct {
+		name        string
+		constraints queryConstraints
+		query       string
+		encoded     string
+	}{
+		{
+			name:        "keywords",
+			constraints: queryConstraints{Keywords: "decompilation techniques"},
+			query:       "decompilation techniques",
+			encoded:     "decompilation+techniques",
+		},
+		{
+			name:        "keywords with OR are grouped",
+			constraints: queryConstraints{Keywords: "decompilation OR disassembly", Subjects: []string{"Computer Science"}},
+			query:       `(decompilation OR disassembly) AND subject:"Computer Science"`,
+		},
+		{
+			name:        "values of one constraint are joined by OR",
+			constraints: queryConstraints{Keywords: "fuzzing", Subjects: []string{"Computer Science", "Engineering"}, Types: []string{"Journal"}},
+			query:       `fuzzing AND (subject:"Computer Science" OR subject:Engineering) AND type:Journal`,
+		},
+		{
+			name:        "phrases",
+			constraints: queryConstraints{Phrases: []string{"binary translation", ` "quoted" `}},
+			query:       `"binary translation" AND "quoted"`,
+		},
+		{
+			name:        "year range",
+			constraints: queryConstraints{Keywords: "obfuscation", Years: []string{"2018-2020"}},
+			query:       "obfuscation AND (year:2018 OR year:2019 OR year:2020)",
+			encoded:     "obfuscation+AND+%28year%3A2018+OR+year%3A2019+OR+year%3A2020%29",
+		},
+		{
+			name:        "excludes",
+			constraints: queryConstraints{Keywords: "malware", Excludes: []string{"type:Book", "subject:Law and Order"}},
+			query:       `malware AND NOT type:Book AND NOT subject:"Law and Order"`,
+		},
+		{
+			name:        "open access",
+			constraints: queryConstraints{DOIs: []string{"10.1007/s11276-008-0131-4"}, OpenAccess: true},
+			query:       "doi:10.1007/s11276-008-0131-4 AND openaccess:true",
+			encoded:     "doi%3A10.1007%2Fs11276-008-0131-4+AND+openaccess%3Atrue",
+		},
+		{
+			name:        "empty values are skipped",
+			constraints: queryConstraints{Keywords: " ", Subjects: []string{"", " "}, Names: []string{"Salvador Garcia"}},
+			query:       `name:"Salvador Garcia"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := test.constraints.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := query.String(); s != test.query {
+				t.Errorf("query = %s, want %s", s, test.query)
+			}
+			if test.encoded != "" && query.Encode() != test.encoded {
+				t.Errorf("encoded query = %s, want %s", query.Encode(), test.encoded)
+			}
+		})
+	}
+}
+
+func TestQueryConstraintsBuildErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		constraints queryConstraints
+	}{
+		{"nothing", queryConstraints{}},
+		{"only empty values", queryConstraints{Keywords: " ", Subjects: []string{""}}},
+		{"invalid year", queryConstraints{Keywords: "a", Years: []string{"20x"}}},
+		{"invalid exclude", queryConstraints{Keywords: "a", Excludes: []string{"Book"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if query, err := test.constraints.Build(); err == nil {
+				t.Errorf("error expected, query = %s", query.String())
+			}
+		})
+	}
+}
+
+func TestParseYears(t *testing.T) {
+	tests := []struct {
+		value string
+		years []string
+		valid bool
+	}{
+		{"2018", []string{"2018"}, true},
+		{" 2018 ", []string{"2018"}, true},
+		{"2015-2017", []string{"2015", "2016", "2017"}, true},
+		{"2015 - 2016", []string{"2015", "2016"}, true},
+		{"2020-2020", []string{"2020"}, true},
+		{"2020-2015", nil, false},
+		{"1800-2000", nil, false},
+		{"2015-", nil, false},
+		{"year", nil, false},
+		{"", nil, false},
+	}
+
+	for _, test := range tests {
+		years, err := parseYears(test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("parseYears(%q) error = %v, valid %v", test.value, err, test.valid)
+			continue
+		}
+		if !reflect.DeepEqual(years, test.years) {
+			t.Errorf("parseYears(%q) = %v, want %v", test.value, years, test.years)
+		}
+	}
+}
+
+func TestParseConstraint(t *testing.T) {
+	tests := []struct {
+		value, name, constraintValue string
+		valid                        bool
+	}{
+		{"type:Book", "type", "Book", true},
+		{"subject:Computer Science", "subject", "Computer Science", true},
+		{"doi:10.1007/a:b", "doi", "10.1007/a:b", true},
+		{"Book", "", "", false},
+		{":Book", "", "", false},
+		{"type:", "", "", false},
+	}
+
+	for _, test := range tests {
+		name, value, err := parseConstraint(test.value)
+		if (err == nil) != test.valid || name != test.name || value != test.constraintValue {
+			t.Errorf("parseConstraint(%q) = %q, %q, %v", test.value, name, value, err)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrQuotaExceeded = errors.New("Daily quota is exceeded")
+
+// quota file is saved after this many requests or this long after the last save, and on Close
+const quotaSaveRequests = 20
+const quotaSaveInterval = 10 * time.Second
+
+// Token bucket shared by all routines. Tokens are added with given rate (requests per second),
+// up to burst tokens are saved while idle. Optional quota limits number of requests per 24 hours
+type RateLimiter struct {
+	mutex  sync.Mutex
+	name   string
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	quota   int
+	used    int
+	pending int       // requests waiting for a token, they count against quota
+	day     time.Time // start of current quota window
+
+	// quota usage shared with other runs, nil if not saved
+	usage *quotaUsage
+	// requests not saved yet, snapshots are numbered so an older one doesn't overwrite a newer one
+	unsaved  int
+	saved    time.Time
+	snapshot int
+}
+
+// rate <= 0 - no rate limit, quota <= 0 - no daily quota
+func NewRateLimiter(name string, rate float64, quota int) *RateLimiter {
+	burst := math.Max(1, math.Ceil(rate))
+	now := time.Now()
+	return &RateLimiter{
+		name:   name,
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+		quota:  quota,
+		day:    now,
+		saved:  now,
+	}
+}
+
+// Blocks until request can be sent or ctx is cancelled, nil limiter doesn't limit anything.
+// Request is charged against quota only when its wait succeeds
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	now := time.Now()
+
+	if now.Sub(l.day) >= 24*time.Hour {
+		l.day, l.used = now, 0
+	}
+
+	if l.quota > 0 && l.used+l.pending >= l.quota {
+		l.mutex.Unlock()
+		return fmt.Errorf("%w (%d %s requests)", ErrQuotaExceeded, l.quota, l.name)
+	}
+
+	var wait time.Duration
+	if l.rate > 0 {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+
+		// token is reserved even if it is not there yet, so waiting routines are served in order
+		l.tokens--
+		if l.tokens < 0 {
+			wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		}
+	}
+	l.pending++
+	l.mutex.Unlock()
+
+	err := sleepContext(ctx, wait)
+
+	l.mutex.Lock()
+	l.pending--
+	if err != nil {
+		l.mutex.Unlock()
+		return err
+	}
+
+	l.used++
+	l.unsaved++
+	save := l.usage != nil && (l.unsaved >= quotaSaveRequests || time.Since(l.saved) >= quotaSaveInterval)
+	var window quotaWindow
+	var snapshot int
+	if save {
+		window, snapshot = l.takeSnapshot()
+	}
+	l.mutex.Unlock()
+
+	if save {
+		if err = l.usage.save(window, snapshot); err != nil {
+			return fmt.Errorf("Can't save quota usage: %v", err)
+		}
+	}
+	return nil
+}
+
+// must be called with mutex locked
+func (l *RateLimiter) takeSnapshot() (quotaWindow, int) {
+	l.unsaved = 0
+	l.saved = time.Now()
+	l.snapshot++
+	return quotaWindow{Used: l.used, Start: l.day}, l.snapshot
+}
+
+// saves requests not saved yet, nil limiter or limiter without quota file does nothing
+func (l *RateLimiter) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	if l.usage == nil || l.unsaved == 0 {
+		l.mutex.Unlock()
+		return nil
+	}
+	window, snapshot := l.takeSnapshot()
+	l.mutex.Unlock()
+
+	if err := l.usage.save(window, snapshot); err != nil {
+		return fmt.Errorf("Can't save quota usage: %v", err)
+	}
+	return nil
+}
+
+// number of requests sent in current quota window
+func (l *RateLimiter) Used() int {
+	if l == nil {
+		return 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.used
+}
+
+// Quota window of one API key saved between runs
+type quotaWindow struct {
+	Used  int       `json:"used"`
+	Start time.Time `json:"start"`
+}
+
+// File with quota windows of API keys (by hash), so runs on the same day
+// (facets, harvest, resumed harvest) share the daily quota
+type quotaUsage struct {
+	mutex   sync.Mutex
+	path    string
+	key     string
+	windows map[string]quotaWindow
+
+	// number of the last saved snapshot
+	saved int
+}
+
+// The whole file is replaced so it is never cut off. Snapshot older than the saved one is skipped
+func (u *quotaUsage) save(window quotaWindow, snapshot int) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if snapshot <= u.saved {
+		return nil
+	}
+	u.windows[u.key] = window
+
+	data, err := json.MarshalIndent(u.windows, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := u.path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, u.path); err != nil {
+		return err
+	}
+	u.saved = snapshot
+	return nil
+}
+
+// Continues quota window of the key saved by previous runs, requests are saved to the file from now on.
+// Windows older than 24 hours are dropped
+func (l *RateLimiter) LoadQuota(path, key string) error {
+	usage := &quotaUsage{path: path, key: key, windows: make(map[string]quotaWindow)}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err = json.Unmarshal(data, &usage.windows); err != nil {
+			return fmt.Errorf("Invalid quota file '%s': %v", path, err)
+		}
+	}
+
+	now := time.Now()
+	for k, window := range usage.windows {
+		if now.Sub(window.Start) >= 24*time.Hour {
+			delete(usage.windows, k)
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if window, ok := usage.windows[key]; ok {
+		l.day, l.used = window.Start, window.Used
+	}
+	l.usage = usage
+	return nil
+}
+
+// start of current quota window
+func (l *RateLimiter) WindowStart() time.Time {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.day
+}
+
+// budgets of outbound requests, set from flags
+var springerLimiter, landingLimiter, pdfLimiter *RateLimiter
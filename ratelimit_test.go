@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterQuota(t *testing.T) {
+	limiter := NewRateLimiter("test", 0, 3)
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+
+	if err := limiter.Wait(context.Background()); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("error = %v, want ErrQuotaExceeded", err)
+	}
+	if used := limiter.Used(); used != 3 {
+		t.Errorf("used = %d, want 3", used)
+	}
+}
+
+func TestRateLimiterCancelledWait(t *testing.T) {
+	// the first token is free, the next ones wait for an hour
+	limiter := NewRateLimiter("test", 1.0/3600, 2)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	waited := make(chan error)
+	go func() { waited <- limiter.Wait(ctx) }()
+
+	// waiting request holds the rest of the quota
+	time.Sleep(20 * time.Millisecond)
+	if err := limiter.Wait(context.Background()); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("error while request is waiting = %v, want ErrQuotaExceeded", err)
+	}
+
+	cancel()
+	if err := <-waited; !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+	if used := limiter.Used(); used != 1 {
+		t.Errorf("used = %d, want 1, cancelled request isn't charged", used)
+	}
+}
+
+func TestRateLimiterSavesQuota(t *testing.T) {
+	path := filepath.Join(newTestDir(t), "test.quota")
+	saved := func() int {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return 0
+		}
+		var windows map[string]quotaWindow
+		if err = json.Unmarshal(data, &windows); err != nil {
+			t.Fatal(err)
+		}
+		return windows["key"].Used
+	}
+
+	limiter := NewRateLimiter("test", 0, 0)
+	if err := limiter.LoadQuota(path, "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < quotaSaveRequests+1; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if used := saved(); used != quotaSaveRequests {
+		t.Errorf("saved %d requests, want %d", used, quotaSaveRequests)
+	}
+
+	if err := limiter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if used := saved(); used != quotaSaveRequests+1 {
+		t.Errorf("saved %d requests after Close, want %d", used, quotaSaveRequests+1)
+	}
+
+	// the next run continues the window
+	next := NewRateLimiter("test", 0, 0)
+	if err := next.LoadQuota(path, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if used := next.Used(); used != quotaSaveRequests+1 {
+		t.Errorf("loaded %d requests, want %d", used, quotaSaveRequests+1)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// file attribute of an item that refers to missing object
+type danglingFile struct {
+	table     *DataBase
+	item      ArticleMetaInfo
+	attribute string // FileName or JATSFileName
+	file      string
+}
+
+// Differences between bucket objects and rows of the tables sharing the bucket
+type reconcileReport struct {
+	objects int
+	rows    int
+
+	// objects no row refers to
+	orphans []ObjectInfo
+	// rows referring to missing objects
+	dangling []danglingFile
+}
+
+// file attributes of stored items
+func itemFiles(item ArticleMetaInfo) map[string]string {
+	return map[string]string{
+		"FileName":     item.FileName,
+		"JATSFileName": item.JATSFileName,
+	}
+}
+
+// Objects are listed before rows, so files uploaded during reconciliation may be reported as dangling,
+// and objects whose rows are not written yet as orphans. With prefix only objects and files under it are compared.
+// Identical files are stored once, so every table storing files in the bucket must be given,
+// objects referred only by other tables are reported as orphans
+func reconcile(ctx context.Context, tables []*DataBase, manager *S3Manager, bucketname, prefix string, segments int) (*reconcileReport, error) {
+	report := &reconcileReport{}
+
+	objects := make(map[string]ObjectInfo)
+	listing := manager.Objects(ctx, bucketname, ListOptions{Prefix: prefix})
+	for listing.Next() {
+		objects[listing.Object().Key] = listing.Object()
+	}
+	if err := listing.Err(); err != nil {
+		return nil, err
+	}
+	report.objects = len(objects)
+
+	referenced := make(map[string]bool)
+	for _, table := range tables {
+		table := table
+		rows, err := table.Find(ctx, table.schema.Name, TableQuery{Segments: segments}, func(item ArticleMetaInfo) error {
+			for attribute, file := range itemFiles(item) {
+				if file == "" || !strings.HasPrefix(file, prefix) {
+					continue
+				}
+
+				referenced[file] = true
+				if _, ok := objects[file]; !ok {
+					report.dangling = append(report.dangling, danglingFile{table: table, item: item, attribute: attribute, file: file})
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		report.rows += rows
+	}
+
+	for key, object := range objects {
+		if !referenced[key] {
+			report.orphans = append(report.orphans, object)
+		}
+	}
+	sort.Slice(report.orphans, func(i, j int) bool {
+		return report.orphans[i].Key < report.orphans[j].Key
+	})
+	sort.Slice(report.dangling, func(i, j int) bool {
+		if report.dangling[i].file == report.dangling[j].file {
+			return report.dangling[i].table.schema.Name < report.dangling[j].table.schema.Name
+		}
+		return report.dangling[i].file < report.dangling[j].file
+	})
+	return report, nil
+}
+
+// Report is a snapshot, a harvest may be writing into the table and bucket meanwhile.
+// Returns orphans older than minAge (temporary .upload-* keys of running harvest are newer)
+// that no row refers to after the tables are scanned again
+func recheckOrphans(ctx context.Context, tables []*DataBase, orphans []ObjectInfo, minAge time.Duration) ([]string, error) {
+	var keys []string
+	for _, object := range orphans {
+		if time.Since(object.LastModified) >= minAge {
+			keys = append(keys, object.Key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return unreferencedFiles(ctx, tables, keys)
+}
+
+// Removes file attribute if it still refers to the same file
+func (db *DataBase) removeFileAttribute(ctx context.Context, item ArticleMetaInfo, attribute, file string) error {
+	key, err := keyOf(db.schema, item)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.svc.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(db.schema.Name),
+		Key:                 db.keyAttributes(key),
+		UpdateExpression:    aws.String("REMOVE #file"),
+		ConditionExpression: aws.String("#file = :file"),
+		ExpressionAttributeNames: map[string]*string{
+			"#file": aws.String(attribute),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":file": {S: aws.String(file)},
+		},
+	})
+
+	// changed by somebody else
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	return err
+}
+
+// result of -fix
+type reconcileFix struct {
+	deleted  int // orphans
+	kept     int // orphans modified recently or referenced again
+	removed  int // dangling references
+	uploaded int // dangling files uploaded after listing
+}
+
+// Deletes orphans and removes dangling references of the report, both are checked again first
+func fixReconcile(ctx context.Context, tables []*DataBase, manager *S3Manager, bucketname string, report *reconcileReport, minAge time.Duration) (fix reconcileFix, errs *errorList) {
+	errs = &errorList{}
+
+	orphans, err := recheckOrphans(ctx, tables, report.orphans, minAge)
+	if err != nil {
+		errs.add(err)
+		return
+	}
+	fix.kept = len(report.orphans) - len(orphans)
+	fix.deleted, err = manager.DeleteKeys(ctx, bucketname, orphans)
+	errs.add(err)
+
+	for _, d := range report.dangling {
+		// object may be uploaded after listing
+		exists, err := manager.ObjectExists(ctx, bucketname, d.file)
+		if err != nil {
+			errs.add(fmt.Errorf("%s: %v", d.item.DOI, err))
+			continue
+		}
+		if exists {
+			fix.uploaded++
+			continue
+		}
+
+		if err := d.table.removeFileAttribute(ctx, d.item, d.attribute, d.file); err != nil {
+			errs.add(fmt.Errorf("%s: %v", d.item.DOI, err))
+			continue
+		}
+		fix.removed++
+	}
+	return
+}
+
+const reconcileUsage = `  Compares S3 bucket objects with table rows. Reports objects no row refers to (orphans)
+  and rows referring to missing objects (dangling FileName/JATSFileName).
+  With -fix orphans are deleted and dangling references are removed, both are checked again before that.
+  Identical files are stored once and may be shared by tables harvested into the same bucket,
+  so every such table must be given with -tablename, otherwise files of other tables are deleted as orphans. Example:
+  springerMetaInfo reconcile -tablename="SampleTable" -tablename="OtherTable" -bucketname="myuniquebucketname3287"`
+
+func runReconcileCommand(args []string) {
+	flags := newCommandFlags("reconcile", reconcileUsage)
+
+	var tablenames listFlag
+	flags.Var(&tablenames, "tablename", "Table with metadata referring to files of the bucket, can be repeated (every table using the bucket). Example: -tablename=\"Music\"")
+	bucketname := flags.String("bucketname", "", "S3 bucket name with files. Example -bucketname=\"myuniquebucketname3287\"")
+	prefix := flags.String("prefix", "", "Only compare objects and files with key prefix. Example: -prefix=\"pdf/\"")
+	segments := flags.Int("segments", 1, "Number of parallel scan segments. Example: -segments=8")
+	fix := flags.Bool("fix", false, "Delete orphans and remove dangling references. Example: -fix")
+	minAge := flags.Int("minage", 60, "Orphans modified within given number of minutes are not deleted by -fix (uploads of running harvest). Example: -minage=10")
+	yes := flags.Bool("yes", false, "Don't ask for confirmation. Example: -yes")
+	credentials := addAWSFlags(flags)
+	flags.Parse(args)
+
+	requireFlag(flags, "tablename", tablenames.String())
+	requireFlag(flags, "bucketname", *bucketname)
+	if *segments < 1 {
+		fmt.Fprintln(os.Stderr, "Invalid segments number :", *segments)
+		os.Exit(1)
+	}
+	if *minAge < 0 {
+		fmt.Fprintln(os.Stderr, "Invalid min age :", *minAge)
+		os.Exit(1)
+	}
+	ctx := interruptContext()
+
+	database, err := credentials.database()
+	check(err)
+	tables, err := openTables(ctx, database, tablenames)
+	check(err)
+
+	manager, err := credentials.bucketManager()
+	check(err)
+
+	report, err := reconcile(ctx, tables, manager, *bucketname, *prefix, *segments)
+	check(err)
+
+	fmt.Printf("Objects: %d, rows: %d (tables: %s)\n", report.objects, report.rows, strings.Join(tablenames, ", "))
+	fmt.Println("Orphans -", len(report.orphans))
+	for _, object := range report.orphans {
+		fmt.Println("\t" + object.Key)
+	}
+	fmt.Println("Dangling references -", len(report.dangling))
+	for _, d := range report.dangling {
+		fmt.Printf("\t%s: %s: %s = %s\n", d.table.schema.Name, d.item.DOI, d.attribute, d.file)
+	}
+
+	if !*fix || len(report.orphans)+len(report.dangling) == 0 {
+		return
+	}
+	question := fmt.Sprintf("Delete %d orphan(-s) and remove %d dangling reference(-s)? Files of tables other than %s will be deleted",
+		len(report.orphans), len(report.dangling), strings.Join(tablenames, ", "))
+	if !*yes && !confirm(question) {
+		return
+	}
+
+	result, errs := fixReconcile(ctx, tables, manager, *bucketname, report, time.Duration(*minAge)*time.Minute)
+	fmt.Printf("Orphans deleted - %d (kept as recent or referenced again - %d)\n", result.deleted, result.kept)
+	fmt.Printf("Dangling references removed - %d (kept as uploaded meanwhile - %d)\n", result.removed, result.uploaded)
+
+	for _, err := range errs.Errors() {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs.Errors()) > 0 {
+		os.Exit(1)
+	}
+}
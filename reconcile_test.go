@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReconcileFix(t *testing.T) {
+	fake := newFakeDynamoDB()
+	fake.addTable(testSchema,
+		ArticleMetaInfo{DOI: "10.1/1", FileName: "a.pdf"},
+		ArticleMetaInfo{DOI: "10.1/2", FileName: "missing.pdf"},
+		ArticleMetaInfo{DOI: "10.1/3", FileName: "late.pdf"},
+		ArticleMetaInfo{DOI: "10.1/4", FileName: "a.pdf", JATSFileName: "missing.xml"},
+	)
+	other := testSchema
+	other.Name = "Other"
+	fake.addTable(other, ArticleMetaInfo{DOI: "10.1/5", FileName: "shared.pdf"})
+
+	s3 := newFakeS3()
+	old := time.Now().Add(-time.Hour)
+	for _, key := range []string{"a.pdf", "shared.pdf", "orphan.pdf", "referenced.pdf"} {
+		s3.addObject("bucket", key, "%PDF", old)
+	}
+	// temporary key of running harvest
+	s3.addObject("bucket", "recent.pdf", "%PDF", time.Now())
+
+	ctx := context.Background()
+	articles, otherTable := newFakeDataBase(t, fake, "Articles"), newFakeDataBase(t, fake, "Other")
+	tables := []*DataBase{articles, otherTable}
+	manager := newFakeS3Manager(t, s3, "")
+
+	report, err := reconcile(ctx, tables, manager, "bucket", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.objects != 5 || report.rows != 5 {
+		t.Errorf("%d objects and %d rows, want 5 and 5", report.objects, report.rows)
+	}
+
+	// file of other table isn't an orphan
+	var orphans []string
+	for _, object := range report.orphans {
+		orphans = append(orphans, object.Key)
+	}
+	if want := []string{"orphan.pdf", "recent.pdf", "referenced.pdf"}; !reflect.DeepEqual(orphans, want) {
+		t.Errorf("orphans = %v, want %v", orphans, want)
+	}
+	var dangling []string
+	for _, d := range report.dangling {
+		dangling = append(dangling, d.item.DOI+" "+d.attribute+" "+d.file)
+	}
+	if want := []string{"10.1/3 FileName late.pdf", "10.1/2 FileName missing.pdf", "10.1/4 JATSFileName missing.xml"}; !reflect.DeepEqual(dangling, want) {
+		t.Errorf("dangling = %v, want %v", dangling, want)
+	}
+
+	// harvest goes on after the report
+	s3.addObject("bucket", "late.pdf", "%PDF", time.Now())
+	if err = otherTable.Put(ctx, ArticleMetaInfo{DOI: "10.1/6", FileName: "referenced.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+
+	fix, errs := fixReconcile(ctx, tables, manager, "bucket", report, 10*time.Minute)
+	if len(errs.Errors()) > 0 {
+		t.Fatal(errs.Errors())
+	}
+	if want := (reconcileFix{deleted: 1, kept: 2, removed: 2, uploaded: 1}); fix != want {
+		t.Errorf("fix = %+v, want %+v", fix, want)
+	}
+
+	if keys, want := s3.keys("bucket"), []string{"a.pdf", "late.pdf", "recent.pdf", "referenced.pdf", "shared.pdf"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("bucket keys = %v, want %v", keys, want)
+	}
+
+	files := make(map[string]ArticleMetaInfo)
+	for _, item := range fake.items("Articles") {
+		files[item.DOI] = item
+	}
+	if item := files["10.1/2"]; item.FileName != "" {
+		t.Errorf("dangling FileName of 10.1/2 = %q, want removed", item.FileName)
+	}
+	if item := files["10.1/4"]; item.JATSFileName != "" || item.FileName != "a.pdf" {
+		t.Errorf("10.1/4 files = %q, %q, want only JATSFileName removed", item.FileName, item.JATSFileName)
+	}
+	if item := files["10.1/3"]; item.FileName != "late.pdf" {
+		t.Errorf("uploaded FileName of 10.1/3 = %q, want kept", item.FileName)
+	}
+}
@@ -1,171 +1,308 @@
-package main
-
-import (
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-    "github.com/aws/aws-sdk-go/aws/session"
-    "github.com/aws/aws-sdk-go/service/s3"
-    "github.com/aws/aws-sdk-go/service/s3/s3manager"
-    "os"
-)
-
-type S3Manager struct {
-	svc			*s3.S3
-	uploader	*s3manager.Uploader
-	downloader	*s3manager.Downloader
-}
-
-func (s *S3Manager) Init(accessKeyID, secretAccessKey, region string) error {
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String(region),
-		Credentials: credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
-	})
-	if err != nil {
-		return err
-	}
-
-	// check if credentials have been found
-	_, err = sess.Config.Credentials.Get()
-	if err != nil {
-		return err
-	}
-
-	s.uploader = s3manager.NewUploader(sess)
-	s.downloader = s3manager.NewDownloader(sess)
-	s.svc = s3.New(sess)
-	return nil	
-}
-
-func (s *S3Manager) InitAuto() error {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-
-	// check if creadentials have been found
-	_, err := sess.Config.Credentials.Get()
-	if err != nil {
-		return err
-	}
-
-	s.uploader = s3manager.NewUploader(sess)
-	s.downloader = s3manager.NewDownloader(sess)
-	s.svc = s3.New(sess)
-	return nil
-}
-
-func (s *S3Manager) CreateBucket(bucketname string) error {
-	_, err := s.svc.CreateBucket(&s3.CreateBucketInput{
-		Bucket : aws.String(bucketname),
-	})
-
-	if err != nil {
-		return err
-	}
-
-	// Wait until bucket is created before finishing
-	err = s.svc.WaitUntilBucketExists(&s3.HeadBucketInput{
-		Bucket : aws.String(bucketname),
-	})
-
-	return err
-}
-
-func (s *S3Manager) ListBuckets() (bucketnames []string, err error) {
-	result, err := s.svc.ListBuckets(nil)
-	if err != nil {
-		return nil, err
-	}
-	for _, bucket := range result.Buckets {
-		bucketnames = append(bucketnames, aws.StringValue(bucket.Name))
-	}
-	return
-}
-
-func (s *S3Manager) ListBucketsItemNames(bucketname string) (itemnames []string, err error) {
-	resp, err := s.svc.ListObjectsV2(&s3.ListObjectsV2Input{
-		Bucket : aws.String(bucketname),
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	for _, item := range resp.Contents {
-		itemnames = append(itemnames, *item.Key)
-	}
-	return
-}
-
-func (s *S3Manager) CreateBucketIfNotExists(bucketname string) error {
-	bucketnames, err := s.ListBuckets()
-	if err != nil {
-		return err
-	}
-
-	for _, b := range bucketnames {
-		if b == bucketname {
-			return nil
-		}
-	}
-
-	return s.CreateBucket(bucketname)
-}
-
-func (s *S3Manager) UploadFile(bucketname string, file *os.File) error {
-	filename := file.Name()
-	_, err := s.uploader.Upload(&s3manager.UploadInput{
-		Bucket : aws.String(bucketname),
-		Key : aws.String(filename),
-		Body : file,
-	})
-
-	// wait until the object is added
-	err = s.svc.WaitUntilObjectExists(&s3.HeadObjectInput{
-	    Bucket: aws.String(bucketname),
-	    Key:    aws.String(filename),
-	})
-
-	return err
-}
-
-func (s *S3Manager) DeleteItem(bucketname, itemKey string) error {
-	_, err := s.svc.DeleteObject(&s3.DeleteObjectInput{
-		Bucket : aws.String(bucketname),
-		Key : aws.String(itemKey),
-	})
-
-	if err != nil {
-		return err
-	}
-
-	// wait until the object is deleted
-	err = s.svc.WaitUntilObjectNotExists(&s3.HeadObjectInput{
-	    Bucket: aws.String(bucketname),
-	    Key:    aws.String(itemKey),
-	})
-
-	return err
-}
-
-func (s *S3Manager) DeleteBucket(bucketname string) error {
-	_, err := s.svc.DeleteBucket(&s3.DeleteBucketInput{
-	    Bucket: aws.String(bucketname),
-	})
-	if err != nil {
-		return err
-	}
-
-	err = s.svc.WaitUntilBucketNotExists(&s3.HeadBucketInput{
-	    Bucket: aws.String(bucketname),
-	})
-
-	return err
-}
-
-func (s *S3Manager) DownloadItem(bucketname, itemKey string) (file *os.File, err error) {
-	_, err = s.downloader.Download(file, &s3.GetObjectInput{
-        Bucket: aws.String(bucketname),
-        Key:    aws.String(itemKey),
-    })
-    return
-}
\ No newline at end of file
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+    "github.com/aws/aws-sdk-go/aws/session"
+    "github.com/aws/aws-sdk-go/service/s3"
+    "github.com/aws/aws-sdk-go/service/s3/s3manager"
+    "fmt"
+    "io"
+    "net/url"
+    "os"
+)
+
+type S3Manager struct {
+	svc			*s3.S3
+	uploader	*s3manager.Uploader
+	downloader	*s3manager.Downloader
+	bucket		string
+}
+
+func (s *S3Manager) Init(accessKeyID, secretAccessKey, region string) error {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(region),
+		Credentials: credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
+	})
+	if err != nil {
+		return err
+	}
+
+	// check if credentials have been found
+	_, err = sess.Config.Credentials.Get()
+	if err != nil {
+		return err
+	}
+
+	s.uploader = s3manager.NewUploader(sess)
+	s.downloader = s3manager.NewDownloader(sess)
+	s.svc = s3.New(sess)
+	return nil	
+}
+
+func (s *S3Manager) InitAuto() error {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	// check if creadentials have been found
+	_, err := sess.Config.Credentials.Get()
+	if err != nil {
+		return err
+	}
+
+	s.uploader = s3manager.NewUploader(sess)
+	s.downloader = s3manager.NewDownloader(sess)
+	s.svc = s3.New(sess)
+	return nil
+}
+
+func (s *S3Manager) CreateBucket(ctx context.Context, bucketname string) error {
+	_, err := s.svc.CreateBucketWithContext(ctx, &s3.CreateBucketInput{
+		Bucket : aws.String(bucketname),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Wait until bucket is created before finishing
+	err = s.svc.WaitUntilBucketExistsWithContext(ctx, &s3.HeadBucketInput{
+		Bucket : aws.String(bucketname),
+	})
+
+	return err
+}
+
+func (s *S3Manager) ListBuckets(ctx context.Context) (bucketnames []string, err error) {
+	result, err := s.svc.ListBucketsWithContext(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, err
+	}
+	for _, bucket := range result.Buckets {
+		bucketnames = append(bucketnames, aws.StringValue(bucket.Name))
+	}
+	return
+}
+
+// names of all objects, page by page
+func (s *S3Manager) ListBucketsItemNames(ctx context.Context, bucketname string) (itemnames []string, err error) {
+	objects := s.Objects(ctx, bucketname, ListOptions{})
+	for objects.Next() {
+		itemnames = append(itemnames, objects.Object().Key)
+	}
+	return itemnames, objects.Err()
+}
+
+func (s *S3Manager) CreateBucketIfNotExists(ctx context.Context, bucketname string) error {
+	bucketnames, err := s.ListBuckets(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range bucketnames {
+		if b == bucketname {
+			return nil
+		}
+	}
+
+	return s.CreateBucket(ctx, bucketname)
+}
+
+func (s *S3Manager) UploadFile(ctx context.Context, bucketname string, file *os.File) error {
+	filename := file.Name()
+	_, err := s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket : aws.String(bucketname),
+		Key : aws.String(filename),
+		Body : file,
+	})
+
+	// wait until the object is added
+	err = s.svc.WaitUntilObjectExistsWithContext(ctx, &s3.HeadObjectInput{
+	    Bucket: aws.String(bucketname),
+	    Key:    aws.String(filename),
+	})
+
+	return err
+}
+
+func (s *S3Manager) DeleteItem(ctx context.Context, bucketname, itemKey string) error {
+	_, err := s.svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket : aws.String(bucketname),
+		Key : aws.String(itemKey),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// wait until the object is deleted
+	err = s.svc.WaitUntilObjectNotExistsWithContext(ctx, &s3.HeadObjectInput{
+	    Bucket: aws.String(bucketname),
+	    Key:    aws.String(itemKey),
+	})
+
+	return err
+}
+
+func (s *S3Manager) DeleteBucket(ctx context.Context, bucketname string) error {
+	_, err := s.svc.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{
+	    Bucket: aws.String(bucketname),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.svc.WaitUntilBucketNotExistsWithContext(ctx, &s3.HeadBucketInput{
+	    Bucket: aws.String(bucketname),
+	})
+
+	return err
+}
+
+func (s *S3Manager) DownloadItem(ctx context.Context, bucketname, itemKey string) (file *os.File, err error) {
+	_, err = s.downloader.DownloadWithContext(ctx, file, &s3.GetObjectInput{
+        Bucket: aws.String(bucketname),
+        Key:    aws.String(itemKey),
+    })
+    return
+}
+
+// BlobStore implementation
+
+// creates bucket if it doesn't exist and uses it for Put/Get/Delete/List/Exists
+func (s *S3Manager) EnsureBucket(ctx context.Context, bucketname string) error {
+	s.bucket = bucketname
+	return s.CreateBucketIfNotExists(ctx, bucketname)
+}
+
+func (s *S3Manager) Put(ctx context.Context, key string, body io.Reader) error {
+	_, err := s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket : aws.String(s.bucket),
+		Key : aws.String(key),
+		Body : body,
+	})
+	if err != nil {
+		return err
+	}
+
+	// wait until the object is added
+	return s.svc.WaitUntilObjectExistsWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+}
+
+func (s *S3Manager) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	output, err := s.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+func (s *S3Manager) Delete(ctx context.Context, key string) error {
+	return s.DeleteItem(ctx, s.bucket, key)
+}
+
+func (s *S3Manager) List(ctx context.Context) ([]string, error) {
+	return s.ListBucketsItemNames(ctx, s.bucket)
+}
+
+func (s *S3Manager) Exists(ctx context.Context, key string) (bool, error) {
+	return s.ObjectExists(ctx, s.bucket, key)
+}
+
+func (s *S3Manager) ObjectExists(ctx context.Context, bucketname, key string) (bool, error) {
+	_, err := s.svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucketname),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == "NotFound" || aerr.Code() == s3.ErrCodeNoSuchKey) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Copies object and deletes the source, S3 has no rename
+func (s *S3Manager) Move(ctx context.Context, from, to string) error {
+	_, err := s.svc.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucket),
+		CopySource: aws.String(url.PathEscape(s.bucket + "/" + from)),
+		Key:        aws.String(to),
+	})
+	if err != nil {
+		return err
+	}
+	return s.DeleteItem(ctx, s.bucket, from)
+}
+
+// DeleteObjects limit
+const maxDeleteKeys = 1000
+
+// Deletes objects in batches, returns number of deleted objects
+func (s *S3Manager) DeleteKeys(ctx context.Context, bucketname string, keys []string) (deleted int, err error) {
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > maxDeleteKeys {
+			n = maxDeleteKeys
+		}
+
+		objects := make([]*s3.ObjectIdentifier, 0, n)
+		for _, key := range keys[:n] {
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+		}
+		keys = keys[n:]
+
+		output, err := s.svc.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucketname),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return deleted, err
+		}
+
+		// quiet mode reports only failed objects
+		deleted += len(objects) - len(output.Errors)
+		if len(output.Errors) > 0 {
+			first := output.Errors[0]
+			return deleted, fmt.Errorf("%d object(-s) are not deleted, '%s': %s", len(output.Errors), aws.StringValue(first.Key), aws.StringValue(first.Message))
+		}
+	}
+	return
+}
+
+// Deletes every object of the bucket, maxDeleteKeys at a time. progress is called after every batch
+func (s *S3Manager) EmptyBucket(ctx context.Context, bucketname string, progress func(deleted int)) (deleted int, err error) {
+	objects := s.Objects(ctx, bucketname, ListOptions{})
+	keys := make([]string, 0, maxDeleteKeys)
+
+	for {
+		more := objects.Next()
+		if more {
+			keys = append(keys, objects.Object().Key)
+		}
+
+		if len(keys) == maxDeleteKeys || (!more && len(keys) > 0) {
+			n, err := s.DeleteKeys(ctx, bucketname, keys)
+			deleted += n
+			progress(deleted)
+			if err != nil {
+				return deleted, err
+			}
+			keys = keys[:0]
+		}
+
+		if !more {
+			return deleted, objects.Err()
+		}
+	}
+}
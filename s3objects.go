@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// object of a bucket
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string // without quotes, MD5 of content for objects uploaded in one part
+	LastModified time.Time
+
+	// user metadata (x-amz-meta-*), only with ListOptions.Metadata
+	Metadata map[string]string
+}
+
+type ListOptions struct {
+	Prefix string
+
+	// user metadata is not listed, every object needs HeadObject request
+	Metadata bool
+}
+
+// Iterates over bucket objects, pages are requested when needed:
+//
+//	objects := manager.Objects(ctx, bucketname, ListOptions{Prefix: "pdf/"})
+//	for objects.Next() {
+//		fmt.Println(objects.Object().Key)
+//	}
+//	if err := objects.Err(); err != nil { ... }
+type ObjectIterator struct {
+	manager *S3Manager
+	ctx     context.Context
+	input   *s3.ListObjectsV2Input
+	options ListOptions
+
+	page   []*s3.Object
+	last   bool
+	object ObjectInfo
+	err    error
+}
+
+func (s *S3Manager) Objects(ctx context.Context, bucketname string, options ListOptions) *ObjectIterator {
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucketname)}
+	if options.Prefix != "" {
+		input.Prefix = aws.String(options.Prefix)
+	}
+	return &ObjectIterator{manager: s, ctx: ctx, input: input, options: options}
+}
+
+// false when there are no more objects or on error
+func (it *ObjectIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	for len(it.page) == 0 {
+		if it.last {
+			return false
+		}
+
+		output, err := it.manager.svc.ListObjectsV2WithContext(it.ctx, it.input)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.page = output.Contents
+		it.last = !aws.BoolValue(output.IsTruncated)
+		it.input.ContinuationToken = output.NextContinuationToken
+	}
+
+	object := it.page[0]
+	it.page = it.page[1:]
+	it.object = ObjectInfo{
+		Key:          aws.StringValue(object.Key),
+		Size:         aws.Int64Value(object.Size),
+		ETag:         strings.Trim(aws.StringValue(object.ETag), `"`),
+		LastModified: aws.TimeValue(object.LastModified),
+	}
+
+	if it.options.Metadata {
+		output, err := it.manager.svc.HeadObjectWithContext(it.ctx, &s3.HeadObjectInput{
+			Bucket: it.input.Bucket,
+			Key:    object.Key,
+		})
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.object.Metadata = aws.StringValueMap(output.Metadata)
+	}
+	return true
+}
+
+func (it *ObjectIterator) Object() ObjectInfo {
+	return it.object
+}
+
+func (it *ObjectIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestObjectIterator(t *testing.T) {
+	s3 := newFakeS3()
+	s3.pageSize = 2
+	modified := time.Date(2020, 8, 20, 10, 15, 0, 0, time.UTC)
+	for _, key := range []string{"pdf/a.pdf", "pdf/b.pdf", "pdf/c.pdf", "xml/a.xml", "xml/b.xml"} {
+		s3.addObject("bucket", key, "%PDF-"+key, modified)
+	}
+	s3.buckets["bucket"]["pdf/b.pdf"].metadata = map[string]string{"doi": "10.1/2"}
+	manager := newFakeS3Manager(t, s3, "")
+
+	list := func(options ListOptions) (objects []ObjectInfo) {
+		it := manager.Objects(context.Background(), "bucket", options)
+		for it.Next() {
+			objects = append(objects, it.Object())
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return objects
+	}
+	keys := func(objects []ObjectInfo) (keys []string) {
+		for _, object := range objects {
+			keys = append(keys, object.Key)
+		}
+		return keys
+	}
+
+	// every page is requested
+	all := list(ListOptions{})
+	if want := []string{"pdf/a.pdf", "pdf/b.pdf", "pdf/c.pdf", "xml/a.xml", "xml/b.xml"}; !reflect.DeepEqual(keys(all), want) {
+		t.Errorf("keys = %v, want %v", keys(all), want)
+	}
+	first := all[0]
+	if first.Size != int64(len("%PDF-pdf/a.pdf")) || first.ETag != fakeETag([]byte("%PDF-pdf/a.pdf")) || !first.LastModified.Equal(modified) {
+		t.Errorf("object = %+v", first)
+	}
+	if first.Metadata != nil {
+		t.Errorf("metadata is listed without ListOptions.Metadata: %v", first.Metadata)
+	}
+
+	if pdfs := list(ListOptions{Prefix: "pdf/"}); !reflect.DeepEqual(keys(pdfs), []string{"pdf/a.pdf", "pdf/b.pdf", "pdf/c.pdf"}) {
+		t.Errorf("keys with prefix = %v", keys(pdfs))
+	}
+	if none := list(ListOptions{Prefix: "jats/"}); len(none) != 0 {
+		t.Errorf("keys of missing prefix = %v", keys(none))
+	}
+
+	withMetadata := list(ListOptions{Prefix: "pdf/", Metadata: true})
+	if len(withMetadata) != 3 {
+		t.Fatalf("%d objects with metadata, want 3", len(withMetadata))
+	}
+	if metadata := withMetadata[1].Metadata; metadata["Doi"] != "10.1/2" {
+		t.Errorf("metadata = %v, want Doi 10.1/2", metadata)
+	}
+	if metadata := withMetadata[0].Metadata; len(metadata) != 0 {
+		t.Errorf("metadata of object without it = %v", metadata)
+	}
+}
+
+func TestObjectIteratorError(t *testing.T) {
+	it := newFakeS3Manager(t, newFakeS3(), "").Objects(context.Background(), "missing", ListOptions{})
+	if it.Next() {
+		t.Error("object of missing bucket")
+	}
+	if it.Err() == nil {
+		t.Error("error expected")
+	}
+	if it.Next() {
+		t.Error("iteration goes on after error")
+	}
+}
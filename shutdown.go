@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// page or record is left for the next run (-resume)
+var ErrInterrupted = errors.New("Interrupted")
+
+// Graceful shutdown. After Stop routines don't take new pages and records,
+// but finish work in progress. Abort cancels work in progress too
+type Shutdown struct {
+	ctx   context.Context
+	abort context.CancelFunc
+	stop  chan struct{}
+	once  sync.Once
+}
+
+func NewShutdown() *Shutdown {
+	ctx, abort := context.WithCancel(context.Background())
+	return &Shutdown{ctx: ctx, abort: abort, stop: make(chan struct{})}
+}
+
+// context of requests, cancelled by Abort
+func (s *Shutdown) Context() context.Context {
+	return s.ctx
+}
+
+// closed by Stop or Abort
+func (s *Shutdown) Stopped() <-chan struct{} {
+	return s.stop
+}
+
+func (s *Shutdown) Stop() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+func (s *Shutdown) Abort() {
+	s.Stop()
+	s.abort()
+}
+
+func isStopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
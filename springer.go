@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Springer API endpoint. Every endpoint returns its own format,
+// which is converted to the PAM representation (SpringerResponse)
+type SpringerAPI interface {
+	// URL of the page with records starting from start (1-based)
+	PageURL(searchQuery string, start int) string
+	Parse(body []byte) (*SpringerResponse, error)
+}
+
+// -api flag values
+var springerAPIs = map[string]string{
+	"pam":        "metadata/pam",
+	"json":       "metadata/json",
+	"openaccess": "openaccess/json",
+	"jats":       "openaccess/jats",
+}
+
+func NewSpringerAPI(name string) (SpringerAPI, error) {
+	endpoint, ok := springerAPIs[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown API '%s'. Possible APIs - pam/json/openaccess/jats", name)
+	}
+
+	switch name {
+	case "json", "openaccess":
+		return &jsonAPI{endpoint: endpoint, openAccess: name == "openaccess"}, nil
+	case "jats":
+		return &jatsAPI{endpoint: endpoint}, nil
+	}
+	return &pamAPI{endpoint: endpoint}, nil
+}
+
+func formQuery(endpoint string, startPage int, searchQuery string) string {
+	return springerAPIdomain +
+		endpoint +
+		"?q=" +
+		searchQuery +
+		"&s=" + strconv.Itoa(startPage) +
+		"&p=" + strconv.Itoa(pageLength) +
+		"&api_key=" + apiKey
+}
+
+func fetchPage(ctx context.Context, api SpringerAPI, url string) (*SpringerResponse, error) {
+	body, err := springerClient.GetBody(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) == 0 {
+		return nil, errors.New("Empty response")
+	}
+	return api.Parse(body)
+}
+
+// metadata/pam
+
+type pamAPI struct {
+	endpoint string
+}
+
+func (api *pamAPI) PageURL(searchQuery string, start int) string {
+	return formQuery(api.endpoint, start, searchQuery)
+}
+
+func (api *pamAPI) Parse(body []byte) (*SpringerResponse, error) {
+	var response SpringerResponse
+	if err := xml.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// metadata/json and openaccess/json
+
+type jsonAPI struct {
+	endpoint   string
+	openAccess bool
+}
+
+// JSON API returns numbers as strings and some fields as
+// either string, list or object, so collect all text inside
+type jsonText string
+
+func (t *jsonText) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	var parts []string
+	var collect func(v interface{})
+	collect = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			parts = append(parts, v)
+		case float64:
+			parts = append(parts, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			parts = append(parts, strconv.FormatBool(v))
+		case []interface{}:
+			for _, item := range v {
+				collect(item)
+			}
+		case map[string]interface{}:
+			// {"h1": "Abstract", "p": "..."} -> "..."
+			if p, ok := v["p"]; ok {
+				collect(p)
+				return
+			}
+			for _, item := range v {
+				collect(item)
+			}
+		}
+	}
+	collect(value)
+
+	*t = jsonText(strings.Join(parts, " "))
+	return nil
+}
+
+func (t jsonText) Int() int {
+	n, _ := strconv.Atoi(string(t))
+	return n
+}
+
+// string or list of strings
+type jsonStrings []string
+
+func (s *jsonStrings) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*s = list
+		return nil
+	}
+
+	var single string
+	if err := json.Unmarshal(data, &single); err != nil {
+		return err
+	}
+	if single != "" {
+		*s = jsonStrings{single}
+	}
+	return nil
+}
+
+type jsonRecord struct {
+	ContentType     jsonText    `json:"contentType"`
+	Language        jsonText    `json:"language"`
+	Title           jsonText    `json:"title"`
+	PublicationName jsonText    `json:"publicationName"`
+	OpenAccess      jsonText    `json:"openaccess"`
+	DOI             jsonText    `json:"doi"`
+	ISBN            jsonText    `json:"isbn"`
+	EISBN           jsonText    `json:"eIsbn"`
+	ISSN            jsonText    `json:"issn"`
+	EISSN           jsonText    `json:"eIssn"`
+	JournalID       jsonText    `json:"journalId"`
+	Publisher       jsonText    `json:"publisher"`
+	PublicationDate jsonText    `json:"publicationDate"`
+	OnlineDate      jsonText    `json:"onlineDate"`
+	PrintDate       jsonText    `json:"printDate"`
+	Volume          jsonText    `json:"volume"`
+	Number          jsonText    `json:"number"`
+	StartingPage    jsonText    `json:"startingPage"`
+	EndingPage      jsonText    `json:"endingPage"`
+	Copyright       jsonText    `json:"copyright"`
+	Abstract        jsonText    `json:"abstract"`
+	Genre           jsonStrings `json:"genre"`
+	Subjects        jsonStrings `json:"subjects"`
+	Creators        []struct {
+		Creator string `json:"creator"`
+	} `json:"creators"`
+	URL []struct {
+		Format string `json:"format"`
+		Value  string `json:"value"`
+	} `json:"url"`
+}
+
+type jsonResponse struct {
+	Result []struct {
+		Total            jsonText `json:"total"`
+		Start            jsonText `json:"start"`
+		PageLength       jsonText `json:"pageLength"`
+		RecordsDisplayed jsonText `json:"recordsDisplayed"`
+	} `json:"result"`
+	Records []jsonRecord `json:"records"`
+	Facets  []struct {
+		Name   string `json:"name"`
+		Values []struct {
+			Value string   `json:"value"`
+			Count jsonText `json:"count"`
+		} `json:"values"`
+	} `json:"facets"`
+}
+
+func (api *jsonAPI) PageURL(searchQuery string, start int) string {
+	return formQuery(api.endpoint, start, searchQuery)
+}
+
+func (api *jsonAPI) Parse(body []byte) (*SpringerResponse, error) {
+	var page jsonResponse
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, err
+	}
+
+	var response SpringerResponse
+	if len(page.Result) > 0 {
+		response.Result = SpringerResult{
+			Total:            page.Result[0].Total.Int(),
+			Start:            page.Result[0].Start.Int(),
+			PageLength:       page.Result[0].PageLength.Int(),
+			RecordsDisplayed: page.Result[0].RecordsDisplayed.Int(),
+		}
+	}
+
+	for _, r := range page.Records {
+		article := SpringerArticle{
+			Title:           string(r.Title),
+			PublicationName: string(r.PublicationName),
+			Volume:          r.Volume.Int(),
+			Number:          string(r.Number),
+			OpenAccess:      api.openAccess || r.OpenAccess == "true",
+			StartingPage:    r.StartingPage.Int(),
+			EndingPage:      r.EndingPage.Int(),
+			Publisher:       string(r.Publisher),
+			PublicationDate: string(r.PublicationDate),
+			DOI:             string(r.DOI),
+			ISBN:            string(r.ISBN),
+			EISBN:           string(r.EISBN),
+			ISSN:            string(r.ISSN),
+			EISSN:           string(r.EISSN),
+			JournalID:       string(r.JournalID),
+			ContentType:     string(r.ContentType),
+			Genre:           r.Genre,
+			Subjects:        r.Subjects,
+			OnlineDate:      string(r.OnlineDate),
+			PrintDate:       string(r.PrintDate),
+			Copyright:       string(r.Copyright),
+			Language:        string(r.Language),
+		}
+
+		for _, c := range r.Creators {
+			article.Creators = append(article.Creators, c.Creator)
+		}
+
+		// landing page, not PDF
+		for _, u := range r.URL {
+			if u.Format == "" || u.Format == "html" {
+				article.URL = u.Value
+				break
+			}
+		}
+		if article.URL == "" && article.DOI != "" {
+			article.URL = "http://dx.doi.org/" + article.DOI
+		}
+
+		response.Records = append(response.Records, SpringerRecord{Article: article, Abstract: string(r.Abstract)})
+	}
+
+	for _, f := range page.Facets {
+		facet := SpringerFacet{Name: f.Name}
+		for _, v := range f.Values {
+			facet.Values = append(facet.Values, SpringerFacetValue{Value: v.Value, Count: v.Count.Int()})
+		}
+		response.Facets = append(response.Facets, facet)
+	}
+	return &response, nil
+}
+
+// openaccess/jats - full text articles in JATS format
+
+type jatsAPI struct {
+	endpoint string
+}
+
+// text of element with all nested markup removed
+type xmlText string
+
+func (t *xmlText) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var text strings.Builder
+	for depth := 0; ; {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch token := token.(type) {
+		case xml.CharData:
+			text.Write(token)
+		case xml.StartElement:
+			depth++
+			text.WriteString(" ")
+		case xml.EndElement:
+			if depth == 0 {
+				*t = xmlText(strings.Join(strings.Fields(text.String()), " "))
+				return nil
+			}
+			depth--
+		}
+	}
+}
+
+func xmlAttr(attrs []xml.Attr, name string) string {
+	for _, attr := range attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// <issn pub-type="epub">, <article-id pub-id-type="doi">, ...
+type jatsValue struct {
+	Attrs []xml.Attr `xml:",any,attr"`
+	Value string     `xml:",chardata"`
+}
+
+type jatsDate struct {
+	Attrs []xml.Attr `xml:",any,attr"`
+	Year  string     `xml:"year"`
+	Month string     `xml:"month"`
+	Day   string     `xml:"day"`
+}
+
+// "2020-01-02", "2020-01", "2020"
+func (d jatsDate) String() string {
+	date := d.Year
+	for _, part := range []string{d.Month, d.Day} {
+		if part == "" {
+			break
+		}
+		if len(part) == 1 {
+			part = "0" + part
+		}
+		date += "-" + part
+	}
+	return date
+}
+
+// publication-format="electronic" or pub-type="epub"
+func (d jatsDate) kind() string {
+	if format := xmlAttr(d.Attrs, "publication-format"); format != "" {
+		return format
+	}
+	return xmlAttr(d.Attrs, "pub-type")
+}
+
+type jatsArticle struct {
+	Attrs []xml.Attr `xml:",any,attr"`
+	Inner []byte     `xml:",innerxml"`
+
+	JournalIDs   []jatsValue `xml:"front>journal-meta>journal-id"`
+	JournalTitle xmlText     `xml:"front>journal-meta>journal-title-group>journal-title"`
+	ISSNs        []jatsValue `xml:"front>journal-meta>issn"`
+	Publisher    xmlText     `xml:"front>journal-meta>publisher>publisher-name"`
+
+	ArticleIDs []jatsValue `xml:"front>article-meta>article-id"`
+	Subjects   []xmlText   `xml:"front>article-meta>article-categories>subj-group>subject"`
+	Title      xmlText     `xml:"front>article-meta>title-group>article-title"`
+	Contribs   []struct {
+		Type      string `xml:"contrib-type,attr"`
+		Surname   string `xml:"name>surname"`
+		GivenName string `xml:"name>given-names"`
+		Collab    string `xml:"collab"`
+	} `xml:"front>article-meta>contrib-group>contrib"`
+	PubDates  []jatsDate `xml:"front>article-meta>pub-date"`
+	Volume    string     `xml:"front>article-meta>volume"`
+	Issue     string     `xml:"front>article-meta>issue"`
+	FirstPage string     `xml:"front>article-meta>fpage"`
+	LastPage  string     `xml:"front>article-meta>lpage"`
+	Copyright xmlText    `xml:"front>article-meta>permissions>copyright-statement"`
+	Abstract  xmlText    `xml:"front>article-meta>abstract"`
+}
+
+// whole <article> element as it was in the response
+func (a jatsArticle) raw() []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString("<article")
+	for _, attr := range a.Attrs {
+		name := attr.Name.Local
+		if attr.Name.Space == "xmlns" {
+			name = "xmlns:" + name
+		} else if attr.Name.Space == "http://www.w3.org/XML/1998/namespace" {
+			name = "xml:" + name
+		}
+		buffer.WriteString(" " + name + "=\"")
+		xml.EscapeText(&buffer, []byte(attr.Value))
+		buffer.WriteString("\"")
+	}
+	buffer.WriteString(">")
+	buffer.Write(a.Inner)
+	buffer.WriteString("</article>")
+	return buffer.Bytes()
+}
+
+type jatsResponse struct {
+	Result   SpringerResult  `xml:"result"`
+	Articles []jatsArticle   `xml:"records>article"`
+	Facets   []SpringerFacet `xml:"facets>facet"`
+}
+
+func (api *jatsAPI) PageURL(searchQuery string, start int) string {
+	return formQuery(api.endpoint, start, searchQuery)
+}
+
+func (api *jatsAPI) Parse(body []byte) (*SpringerResponse, error) {
+	var page jatsResponse
+	if err := xml.Unmarshal(body, &page); err != nil {
+		return nil, err
+	}
+
+	response := SpringerResponse{Result: page.Result, Facets: page.Facets}
+	for _, a := range page.Articles {
+		article := SpringerArticle{
+			Title:           string(a.Title),
+			PublicationName: string(a.JournalTitle),
+			Number:          a.Issue,
+			OpenAccess:      true,
+			Publisher:       string(a.Publisher),
+			Copyright:       string(a.Copyright),
+			ContentType:     xmlAttr(a.Attrs, "article-type"),
+			Language:        xmlAttr(a.Attrs, "lang"),
+		}
+		article.Volume, _ = strconv.Atoi(a.Volume)
+		article.StartingPage, _ = strconv.Atoi(a.FirstPage)
+		article.EndingPage, _ = strconv.Atoi(a.LastPage)
+
+		for _, id := range a.ArticleIDs {
+			if xmlAttr(id.Attrs, "pub-id-type") == "doi" {
+				article.DOI = strings.TrimSpace(id.Value)
+			}
+		}
+		if article.DOI != "" {
+			article.URL = "http://dx.doi.org/" + article.DOI
+		}
+
+		for _, id := range a.JournalIDs {
+			if xmlAttr(id.Attrs, "journal-id-type") == "publisher-id" {
+				article.JournalID = strings.TrimSpace(id.Value)
+			}
+		}
+
+		for _, issn := range a.ISSNs {
+			switch xmlAttr(issn.Attrs, "pub-type") + xmlAttr(issn.Attrs, "publication-format") {
+			case "epub", "electronic":
+				article.EISSN = strings.TrimSpace(issn.Value)
+			default:
+				article.ISSN = strings.TrimSpace(issn.Value)
+			}
+		}
+
+		for _, subject := range a.Subjects {
+			article.Subjects = append(article.Subjects, string(subject))
+		}
+
+		// "Surname, Given-Names" like in PAM
+		for _, c := range a.Contribs {
+			if c.Type != "" && c.Type != "author" {
+				continue
+			}
+			switch {
+			case c.Surname != "" && c.GivenName != "":
+				article.Creators = append(article.Creators, c.Surname+", "+c.GivenName)
+			case c.Surname != "":
+				article.Creators = append(article.Creators, c.Surname)
+			case c.Collab != "":
+				article.Creators = append(article.Creators, c.Collab)
+			}
+		}
+
+		for _, date := range a.PubDates {
+			switch date.kind() {
+			case "epub", "electronic":
+				article.OnlineDate = date.String()
+			case "ppub", "print":
+				article.PrintDate = date.String()
+			}
+		}
+		article.PublicationDate = article.OnlineDate
+		if article.PublicationDate == "" {
+			article.PublicationDate = article.PrintDate
+		}
+		if article.PublicationDate == "" && len(a.PubDates) > 0 {
+			article.PublicationDate = a.PubDates[0].String()
+		}
+
+		response.Records = append(response.Records, SpringerRecord{
+			Article:  article,
+			Abstract: string(a.Abstract),
+			jats:     a.raw(),
+		})
+	}
+	return &response, nil
+}
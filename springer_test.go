@@ -0,0 +1,510 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONText(t *testing.T) {
+	tests := []struct {
+		json string
+		text jsonText
+	}{
+		{`"Decompilation"`, "Decompilation"},
+		{`"12"`, "12"},
+		{`12`, "12"},
+		{`true`, "true"},
+		{`null`, ""},
+		{`["1234-5678", "8765-4321"]`, "1234-5678 8765-4321"},
+		{`{"h1": "Abstract", "p": "Text of abstract"}`, "Text of abstract"},
+		{`{"h1": "Abstract", "p": ["First.", "Second."]}`, "First. Second."},
+		{`[{"h1": "Abstract", "p": "Text"}]`, "Text"},
+	}
+
+	for _, test := range tests {
+		var text jsonText
+		if err := json.Unmarshal([]byte(test.json), &text); err != nil {
+			t.Errorf("%s: %v", test.json, err)
+			continue
+		}
+		if text != test.text {
+			t.Errorf("%s: text = %q, want %q", test.json, text, test.text)
+		}
+	}
+}
+
+func TestJSONStrings(t *testing.T) {
+	tests := []struct {
+		json    string
+		strings jsonStrings
+		valid   bool
+	}{
+		{`["Computer Science", "Engineering"]`, jsonStrings{"Computer Science", "Engineering"}, true},
+		{`"Computer Science"`, jsonStrings{"Computer Science"}, true},
+		{`""`, nil, true},
+		{`[]`, jsonStrings{}, true},
+		{`12`, nil, false},
+	}
+
+	for _, test := range tests {
+		var s jsonStrings
+		err := json.Unmarshal([]byte(test.json), &s)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: error = %v, valid %v", test.json, err, test.valid)
+			continue
+		}
+		if test.valid && !reflect.DeepEqual(s, test.strings) {
+			t.Errorf("%s: strings = %#v, want %#v", test.json, s, test.strings)
+		}
+	}
+}
+
+const testJSONPage = `{
+	"result": [{"total": "120", "start": "11", "pageLength": "10", "recordsDisplayed": "2"}],
+	"records": [
+		{
+			"contentType": "Article",
+			"language": "en",
+			"title": "Decompilation of binaries",
+			"creators": [{"creator": "Garcia, Salvador"}, {"creator": "Smith, John"}],
+			"publicationName": "Wireless Networks",
+			"openaccess": "true",
+			"doi": "10.1007/s11276-008-0131-4",
+			"issn": "1022-0038",
+			"eIssn": "1572-8196",
+			"journalId": "11276",
+			"publisher": "Springer",
+			"publicationDate": "2008-06-05",
+			"onlineDate": "2008-06-05",
+			"volume": "16",
+			"number": "3",
+			"startingPage": "633",
+			"endingPage": "651",
+			"copyright": "©2008 Springer",
+			"genre": ["OriginalPaper", "Research"],
+			"subjects": "Engineering",
+			"url": [
+				{"format": "pdf", "value": "http://link.springer.com/content/pdf/10.1007/s11276-008-0131-4.pdf"},
+				{"format": "html", "value": "http://link.springer.com/article/10.1007/s11276-008-0131-4"}
+			],
+			"abstract": {"h1": "Abstract", "p": "Abstract text"}
+		},
+		{
+			"title": "No landing page",
+			"doi": "10.1007/978-3-540-1",
+			"openaccess": "false",
+			"volume": ""
+		}
+	],
+	"facets": [{"name": "subject", "values": [{"value": "Engineering", "count": "7"}]}]
+}`
+
+func TestJSONAPIParse(t *testing.T) {
+	api, err := NewSpringerAPI("json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := api.Parse([]byte(testJSONPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := SpringerResult{Total: 120, Start: 11, PageLength: 10, RecordsDisplayed: 2}
+	if response.Result != result {
+		t.Errorf("result = %+v, want %+v", response.Result, result)
+	}
+
+	facets := []SpringerFacet{{Name: "subject", Values: []SpringerFacetValue{{Value: "Engineering", Count: 7}}}}
+	if !reflect.DeepEqual(response.Facets, facets) {
+		t.Errorf("facets = %+v, want %+v", response.Facets, facets)
+	}
+
+	if len(response.Records) != 2 {
+		t.Fatalf("%d records, want 2", len(response.Records))
+	}
+
+	article := SpringerArticle{
+		Title:           "Decompilation of binaries",
+		Creators:        []string{"Garcia, Salvador", "Smith, John"},
+		PublicationName: "Wireless Networks",
+		Volume:          16,
+		Number:          "3",
+		OpenAccess:      true,
+		StartingPage:    633,
+		EndingPage:      651,
+		Publisher:       "Springer",
+		PublicationDate: "2008-06-05",
+		URL:             "http://link.springer.com/article/10.1007/s11276-008-0131-4",
+		DOI:             "10.1007/s11276-008-0131-4",
+		ISSN:            "1022-0038",
+		EISSN:           "1572-8196",
+		JournalID:       "11276",
+		ContentType:     "Article",
+		Genre:           []string{"OriginalPaper", "Research"},
+		Subjects:        []string{"Engineering"},
+		OnlineDate:      "2008-06-05",
+		Copyright:       "©2008 Springer",
+		Language:        "en",
+	}
+	if !reflect.DeepEqual(response.Records[0].Article, article) {
+		t.Errorf("article = %+v\nwant %+v", response.Records[0].Article, article)
+	}
+	if response.Records[0].Abstract != "Abstract text" {
+		t.Errorf("abstract = %q", response.Records[0].Abstract)
+	}
+
+	second := response.Records[1].Article
+	if second.URL != "http://dx.doi.org/10.1007/978-3-540-1" || second.OpenAccess || second.Volume != 0 {
+		t.Errorf("second article = %+v", second)
+	}
+}
+
+func TestOpenAccessAPIParse(t *testing.T) {
+	api, err := NewSpringerAPI("openaccess")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := api.Parse([]byte(`{"records": [{"doi": "10.1007/1"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Records) != 1 || !response.Records[0].Article.OpenAccess {
+		t.Errorf("records of openaccess API should be open access: %+v", response.Records)
+	}
+}
+
+func TestJSONAPIParseErrors(t *testing.T) {
+	api, _ := NewSpringerAPI("json")
+	for _, body := range []string{"<response/>", `{"records": "none"}`, `{"records": [{"genre": 1}]}`} {
+		if _, err := api.Parse([]byte(body)); err == nil {
+			t.Errorf("%s: error expected", body)
+		}
+	}
+}
+
+func TestJATSDate(t *testing.T) {
+	tests := []struct {
+		date jatsDate
+		s    string
+	}{
+		{jatsDate{Year: "2020", Month: "1", Day: "2"}, "2020-01-02"},
+		{jatsDate{Year: "2020", Month: "11", Day: "30"}, "2020-11-30"},
+		{jatsDate{Year: "2020", Month: "05"}, "2020-05"},
+		{jatsDate{Year: "2020", Day: "5"}, "2020"},
+		{jatsDate{Year: "2020"}, "2020"},
+	}
+
+	for _, test := range tests {
+		if s := test.date.String(); s != test.s {
+			t.Errorf("%+v: date = %s, want %s", test.date, s, test.s)
+		}
+	}
+}
+
+const testJATSArticle = `<article xmlns:xlink="http://www.w3.org/1999/xlink" article-type="research-article" xml:lang="en">` +
+	`<front>` +
+	`<journal-meta>` +
+	`<journal-id journal-id-type="nlm-ta">Wirel Netw</journal-id>` +
+	`<journal-id journal-id-type="publisher-id">11276</journal-id>` +
+	`<journal-title-group><journal-title>Wireless <italic>Networks</italic></journal-title></journal-title-group>` +
+	`<issn pub-type="ppub">1022-0038</issn>` +
+	`<issn pub-type="epub">1572-8196</issn>` +
+	`<publisher><publisher-name>Springer US</publisher-name></publisher>` +
+	`</journal-meta>` +
+	`<article-meta>` +
+	`<article-id pub-id-type="publisher-id">s11276</article-id>` +
+	`<article-id pub-id-type="doi"> 10.1007/s11276-008-0131-4 </article-id>` +
+	`<article-categories><subj-group><subject>Engineering</subject><subject>Computer Science</subject></subj-group></article-categories>` +
+	`<title-group><article-title>Decompilation of<break/>binaries</article-title></title-group>` +
+	`<contrib-group>` +
+	`<contrib contrib-type="author"><name><surname>Garcia</surname><given-names>Salvador</given-names></name></contrib>` +
+	`<contrib contrib-type="author"><name><surname>Plato</surname></name></contrib>` +
+	`<contrib contrib-type="author"><collab>Decompilation Group</collab></contrib>` +
+	`<contrib contrib-type="editor"><name><surname>Editor</surname><given-names>Some</given-names></name></contrib>` +
+	`</contrib-group>` +
+	`<pub-date pub-type="ppub"><year>2010</year><month>4</month></pub-date>` +
+	`<pub-date publication-format="electronic"><day>5</day><month>6</month><year>2008</year></pub-date>` +
+	`<volume>16</volume><issue>3</issue><fpage>633</fpage><lpage>651</lpage>` +
+	`<permissions><copyright-statement>© Springer 2008</copyright-statement></permissions>` +
+	`<abstract><title>Abstract</title><p>Abstract  text &amp; more</p></abstract>` +
+	`</article-meta>` +
+	`</front>` +
+	`<body><p>Full text</p></body>` +
+	`</article>`
+
+func TestJATSAPIParse(t *testing.T) {
+	api, err := NewSpringerAPI("jats")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `<response>` +
+		`<result><total>1</total><start>1</start><pageLength>10</pageLength><recordsDisplayed>1</recordsDisplayed></result>` +
+		`<records>` + testJATSArticle + `<article><front><article-meta><pub-date><year>1999</year></pub-date></article-meta></front></article></records>` +
+		`<facets><facet name="subject"><facet-value count="1">Engineering</facet-value></facet></facets>` +
+		`</response>`
+	response, err := api.Parse([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := SpringerResult{Total: 1, Start: 1, PageLength: 10, RecordsDisplayed: 1}
+	if response.Result != result {
+		t.Errorf("result = %+v, want %+v", response.Result, result)
+	}
+	if len(response.Facets) != 1 || len(response.Facets[0].Values) != 1 || response.Facets[0].Values[0].Count != 1 {
+		t.Errorf("facets = %+v", response.Facets)
+	}
+	if len(response.Records) != 2 {
+		t.Fatalf("%d records, want 2", len(response.Records))
+	}
+
+	article := SpringerArticle{
+		Title:           "Decompilation of binaries",
+		Creators:        []string{"Garcia, Salvador", "Plato", "Decompilation Group"},
+		PublicationName: "Wireless Networks",
+		Volume:          16,
+		Number:          "3",
+		OpenAccess:      true,
+		StartingPage:    633,
+		EndingPage:      651,
+		Publisher:       "Springer US",
+		PublicationDate: "2008-06-05",
+		URL:             "http://dx.doi.org/10.1007/s11276-008-0131-4",
+		DOI:             "10.1007/s11276-008-0131-4",
+		ISSN:            "1022-0038",
+		EISSN:           "1572-8196",
+		JournalID:       "11276",
+		ContentType:     "research-article",
+		Subjects:        []string{"Engineering", "Computer Science"},
+		OnlineDate:      "2008-06-05",
+		PrintDate:       "2010-04",
+		Copyright:       "© Springer 2008",
+		Language:        "en",
+	}
+	record := response.Records[0]
+	if !reflect.DeepEqual(record.Article, article) {
+		t.Errorf("article = %+v\nwant %+v", record.Article, article)
+	}
+	if record.Abstract != "Abstract Abstract text & more" {
+		t.Errorf("abstract = %q", record.Abstract)
+	}
+
+	// date of unknown kind is used if there is nothing else
+	if date := response.Records[1].Article.PublicationDate; date != "1999" {
+		t.Errorf("publication date = %s, want 1999", date)
+	}
+}
+
+func TestJATSRaw(t *testing.T) {
+	api, _ := NewSpringerAPI("jats")
+	response, err := api.Parse([]byte(`<response><records>` + testJATSArticle + `</records></response>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// stored JATS file is the same article, namespaces and attributes included
+	raw := response.Records[0].jats
+	for _, part := range []string{`xmlns:xlink="http://www.w3.org/1999/xlink"`, `article-type="research-article"`, `xml:lang="en"`, "<body><p>Full text</p></body>"} {
+		if !strings.Contains(string(raw), part) {
+			t.Errorf("%s is lost: %s", part, raw)
+		}
+	}
+
+	var article jatsArticle
+	if err := xml.Unmarshal(raw, &article); err != nil {
+		t.Fatalf("stored JATS isn't valid XML: %v", err)
+	}
+	if string(article.Title) != "Decompilation of binaries" || xmlAttr(article.Attrs, "lang") != "en" {
+		t.Errorf("stored JATS differs: %s, %v", article.Title, article.Attrs)
+	}
+}
+
+func TestNewSpringerAPI(t *testing.T) {
+	for name := range springerAPIs {
+		if _, err := NewSpringerAPI(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := NewSpringerAPI("xml"); err == nil {
+		t.Error("unknown API is accepted")
+	}
+}
+
+const testPAMPage = `<?xml version="1.0" encoding="UTF-8"?>
+<response>
+  <apiMessage>This XML was provided by Springer Nature</apiMessage>
+  <query>decompilation</query>
+  <result>
+    <total>120</total>
+    <start>1</start>
+    <pageLength>2</pageLength>
+    <recordsDisplayed>2</recordsDisplayed>
+  </result>
+  <records>
+    <pam:message xmlns:pam="http://prismstandard.org/namespaces/pam/2.0/" xmlns:xhtml="http://www.w3.org/1999/xhtml">
+      <xhtml:head>
+        <pam:article xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:prism="http://prismstandard.org/namespaces/basic/2.0/">
+          <dc:identifier>doi:10.1007/s11276-008-0131-4</dc:identifier>
+          <dc:title>Decompilation of binaries</dc:title>
+          <dc:creator>Garcia, Salvador</dc:creator>
+          <dc:creator>Smith, John</dc:creator>
+          <prism:publicationName>Wireless Networks</prism:publicationName>
+          <prism:issn>1022-0038</prism:issn>
+          <prism:eIssn>1572-8196</prism:eIssn>
+          <journalId>11276</journalId>
+          <prism:doi>10.1007/s11276-008-0131-4</prism:doi>
+          <dc:publisher>Springer</dc:publisher>
+          <prism:publicationDate>2008-06-05</prism:publicationDate>
+          <onlineDate>2008-06-05</onlineDate>
+          <printDate>2010-04-01</printDate>
+          <prism:volume>16</prism:volume>
+          <prism:number>3</prism:number>
+          <prism:startingPage>633</prism:startingPage>
+          <prism:endingPage>651</prism:endingPage>
+          <prism:url>http://dx.doi.org/10.1007/s11276-008-0131-4</prism:url>
+          <prism:copyright>©2008 Springer</prism:copyright>
+          <prism:contentType>Article</prism:contentType>
+          <prism:genre>OriginalPaper</prism:genre>
+          <prism:genre>Research</prism:genre>
+          <dc:subject>Engineering</dc:subject>
+          <dc:subject>Communications Engineering, Networks</dc:subject>
+          <dc:language>en</dc:language>
+          <openAccess>true</openAccess>
+        </pam:article>
+      </xhtml:head>
+      <xhtml:body>
+        <p>Abstract text</p>
+      </xhtml:body>
+    </pam:message>
+    <pam:message xmlns:pam="http://prismstandard.org/namespaces/pam/2.0/" xmlns:xhtml="http://www.w3.org/1999/xhtml">
+      <xhtml:head>
+        <pam:article xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:prism="http://prismstandard.org/namespaces/basic/2.0/">
+          <dc:title>Chapter without DOI element</dc:title>
+          <prism:isbn>978-3-540-00000-1</prism:isbn>
+          <prism:eIsbn>978-3-540-00000-2</prism:eIsbn>
+          <prism:url>http://dx.doi.org/10.1007/978-3-540-1_5</prism:url>
+          <openAccess>false</openAccess>
+        </pam:article>
+      </xhtml:head>
+    </pam:message>
+  </records>
+  <facets>
+    <facet name="subject">
+      <facet-value count="7">Engineering</facet-value>
+      <facet-value count="3">Computer Science</facet-value>
+    </facet>
+  </facets>
+</response>`
+
+func TestPAMRecordIdentity(t *testing.T) {
+	api, err := NewSpringerAPI("pam")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := api.Parse([]byte(testPAMPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Records) != 2 {
+		t.Fatalf("%d records, want 2", len(response.Records))
+	}
+
+	tests := []struct {
+		record                        SpringerRecord
+		doi, isbn, eisbn, issn, eissn string
+	}{
+		// DOI element
+		{response.Records[0], "10.1007/s11276-008-0131-4", "", "", "1022-0038", "1572-8196"},
+		// DOI from article URL
+		{response.Records[1], "10.1007/978-3-540-1_5", "978-3-540-00000-1", "978-3-540-00000-2", "", ""},
+	}
+
+	for _, test := range tests {
+		a := test.record.Article
+		if doi := test.record.DOI(); doi != test.doi {
+			t.Errorf("DOI = %s, want %s", doi, test.doi)
+		}
+		if a.ISBN != test.isbn || a.EISBN != test.eisbn || a.ISSN != test.issn || a.EISSN != test.eissn {
+			t.Errorf("%s: ISBN %q, eISBN %q, ISSN %q, eISSN %q", test.doi, a.ISBN, a.EISBN, a.ISSN, a.EISSN)
+		}
+	}
+}
+
+func TestPAMAPIParse(t *testing.T) {
+	api, err := NewSpringerAPI("pam")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := api.Parse([]byte(testPAMPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := SpringerResult{Total: 120, Start: 1, PageLength: 2, RecordsDisplayed: 2}
+	if response.Result != result {
+		t.Errorf("result = %+v, want %+v", response.Result, result)
+	}
+
+	facets := []SpringerFacet{{Name: "subject", Values: []SpringerFacetValue{{Value: "Engineering", Count: 7}, {Value: "Computer Science", Count: 3}}}}
+	if !reflect.DeepEqual(response.Facets, facets) {
+		t.Errorf("facets = %+v, want %+v", response.Facets, facets)
+	}
+
+	if len(response.Records) != 2 {
+		t.Fatalf("%d records, want 2", len(response.Records))
+	}
+
+	article := SpringerArticle{
+		Title:           "Decompilation of binaries",
+		Creators:        []string{"Garcia, Salvador", "Smith, John"},
+		PublicationName: "Wireless Networks",
+		Volume:          16,
+		Number:          "3",
+		OpenAccess:      true,
+		StartingPage:    633,
+		EndingPage:      651,
+		Publisher:       "Springer",
+		PublicationDate: "2008-06-05",
+		URL:             "http://dx.doi.org/10.1007/s11276-008-0131-4",
+		DOI:             "10.1007/s11276-008-0131-4",
+		ISSN:            "1022-0038",
+		EISSN:           "1572-8196",
+		JournalID:       "11276",
+		ContentType:     "Article",
+		Genre:           []string{"OriginalPaper", "Research"},
+		Subjects:        []string{"Engineering", "Communications Engineering, Networks"},
+		OnlineDate:      "2008-06-05",
+		PrintDate:       "2010-04-01",
+		Copyright:       "©2008 Springer",
+		Language:        "en",
+	}
+	if !reflect.DeepEqual(response.Records[0].Article, article) {
+		t.Errorf("article = %+v\nwant %+v", response.Records[0].Article, article)
+	}
+	if response.Records[0].Abstract != "Abstract text" {
+		t.Errorf("abstract = %q", response.Records[0].Abstract)
+	}
+
+	// missing elements stay empty
+	second := response.Records[1].Article
+	if second.OpenAccess || second.Volume != 0 || second.Genre != nil || second.Subjects != nil || response.Records[1].Abstract != "" {
+		t.Errorf("second article = %+v", second)
+	}
+}
+
+func TestPAMAPIParseErrors(t *testing.T) {
+	api, _ := NewSpringerAPI("pam")
+	for _, body := range []string{`{"records": []}`, "<response><result><total>many</total></result></response>"} {
+		if _, err := api.Parse([]byte(body)); err == nil {
+			t.Errorf("%s: error expected", body)
+		}
+	}
+}
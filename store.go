@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+var ErrItemNotFound = errors.New("Item not found")
+
+// item key is already taken by an article with another DOI
+type KeyConflictError struct {
+	Key         ItemKey
+	ExistingDOI string
+	DOI         string
+}
+
+func (e *KeyConflictError) Error() string {
+	return fmt.Sprintf("Key %v already belongs to article '%s', not overwriting it with '%s'", e.Key, e.ExistingDOI, e.DOI)
+}
+
+// table name and key attributes of the metadata table
+type TableSchema struct {
+	Name           string
+	PrimaryKey     string
+	PrimaryKeyType string
+	SortKey        string
+	SortKeyType    string
+
+	// global secondary indexes, only DynamoDB tables have them
+	Indexes []IndexSchema `json:"-"`
+}
+
+func (s TableSchema) HasSortKey() bool {
+	return s.SortKey != "" && s.SortKeyType != ""
+}
+
+// primary (and optional sort) key value of a stored item
+type ItemKey struct {
+	Primary string
+	Sort    string
+}
+
+// storage backend for harvested metadata
+type MetadataStore interface {
+	// creates table (directory, ...) if it doesn't exist
+	EnsureSchema(ctx context.Context, schema TableSchema) error
+	Put(ctx context.Context, item ArticleMetaInfo) error
+	Get(ctx context.Context, key ItemKey) (*ArticleMetaInfo, error)
+	Delete(ctx context.Context, key ItemKey) error
+	List(ctx context.Context) ([]ArticleMetaInfo, error)
+}
+
+// Store writing items in batches. done is called when the item is written or failed,
+// Flush writes pending items
+type BatchStore interface {
+	MetadataStore
+	PutAsync(ctx context.Context, item ArticleMetaInfo, done func(err error))
+	Flush(ctx context.Context)
+}
+
+// Extracts key attribute values from an item the same way DynamoDB sees them.
+// Like DynamoDB, empty string keys are rejected (e.g. DOI primary key of a record without DOI),
+// otherwise all such items would share one key
+func keyOf(schema TableSchema, item ArticleMetaInfo) (key ItemKey, err error) {
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return
+	}
+
+	attributeValue := func(name string) (string, error) {
+		value, ok := av[name]
+		if !ok {
+			return "", fmt.Errorf("Attribute '%s' not found in item", name)
+		}
+		if value.S != nil {
+			if *value.S == "" {
+				return "", fmt.Errorf("Attribute '%s' is empty, item '%s' can't be stored", name, item.Title)
+			}
+			return *value.S, nil
+		}
+		if value.N != nil {
+			return *value.N, nil
+		}
+		return "", fmt.Errorf("Attribute '%s' is neither string nor number", name)
+	}
+
+	if key.Primary, err = attributeValue(schema.PrimaryKey); err != nil {
+		return
+	}
+	if schema.HasSortKey() {
+		key.Sort, err = attributeValue(schema.SortKey)
+	}
+	return
+}
+
+// File-backed store. Every item is kept as a JSON file
+// inside <root>/<table name>/
+type FileStore struct {
+	root   string
+	schema TableSchema
+	mutex  sync.Mutex
+}
+
+func NewFileStore(root string) *FileStore {
+	return &FileStore{root: root}
+}
+
+func (fs *FileStore) tableDir() string {
+	return filepath.Join(fs.root, fs.schema.Name)
+}
+
+// keys can contain any characters, so hash them
+func (fs *FileStore) itemPath(key ItemKey) string {
+	sum := sha256.Sum256([]byte(key.Primary + "\x00" + key.Sort))
+	return filepath.Join(fs.tableDir(), hex.EncodeToString(sum[:])+".json")
+}
+
+func (fs *FileStore) schemaPath() string {
+	return filepath.Join(fs.tableDir(), "_schema.json")
+}
+
+func (fs *FileStore) EnsureSchema(ctx context.Context, schema TableSchema) error {
+	if schema.PrimaryKeyType != "N" && schema.PrimaryKeyType != "S" {
+		return errors.New("Incorrect primary key type. Should be 'N' (Number) or 'S' (String)")
+	}
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	// directory has no indexes, every lookup reads all items
+	schema.Indexes = nil
+	fs.schema = schema
+	if err := os.MkdirAll(fs.tableDir(), 0755); err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadFile(fs.schemaPath())
+	if os.IsNotExist(err) {
+		content, err = json.MarshalIndent(schema, "", "\t")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(fs.schemaPath(), content, 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	var existing TableSchema
+	if err = json.Unmarshal(content, &existing); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(existing, schema) {
+		return fmt.Errorf("Table '%s' already exists with different keys (%+v)", schema.Name, existing)
+	}
+	return nil
+}
+
+// Inserts new item or updates item of the same article (DOI)
+func (fs *FileStore) Put(ctx context.Context, item ArticleMetaInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	key, err := keyOf(fs.schema, item)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	path := fs.itemPath(key)
+	if existingContent, err := ioutil.ReadFile(path); err == nil {
+		var existing ArticleMetaInfo
+		if err = json.Unmarshal(existingContent, &existing); err == nil && existing.DOI != "" && item.DOI != "" && existing.DOI != item.DOI {
+			return &KeyConflictError{Key: key, ExistingDOI: existing.DOI, DOI: item.DOI}
+		}
+	}
+
+	// write to temporary file first so readers never see half-written items
+	if err = ioutil.WriteFile(path+".tmp", content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (fs *FileStore) Get(ctx context.Context, key ItemKey) (*ArticleMetaInfo, error) {
+	fs.mutex.Lock()
+	content, err := ioutil.ReadFile(fs.itemPath(key))
+	fs.mutex.Unlock()
+
+	if os.IsNotExist(err) {
+		return nil, ErrItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var item ArticleMetaInfo
+	if err = json.Unmarshal(content, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (fs *FileStore) Delete(ctx context.Context, key ItemKey) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	err := os.Remove(fs.itemPath(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (fs *FileStore) List(ctx context.Context) (items []ArticleMetaInfo, err error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	files, err := ioutil.ReadDir(fs.tableDir())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), "_") || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(fs.tableDir(), file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var item ArticleMetaInfo
+		if err = json.Unmarshal(content, &item); err != nil {
+			return nil, fmt.Errorf("%s: %v", file.Name(), err)
+		}
+		items = append(items, item)
+	}
+	return
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func newTestFileStore(t *testing.T, schema TableSchema) *FileStore {
+	store := NewFileStore(newTestDir(t))
+	if err := store.EnsureSchema(context.Background(), schema); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestFileStoreEnsureSchema(t *testing.T) {
+	dir := newTestDir(t)
+	if err := NewFileStore(dir).EnsureSchema(context.Background(), testSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	titleKey := testSchema
+	titleKey.PrimaryKey = "Title"
+	badType := testSchema
+	badType.PrimaryKeyType = "B"
+
+	tests := []struct {
+		name   string
+		schema TableSchema
+		ok     bool
+	}{
+		{"same keys", testSchema, true},
+		{"indexes are ignored", TableSchema{Name: "Articles", PrimaryKey: "DOI", PrimaryKeyType: "S", Indexes: []IndexSchema{{Name: "ByYear"}}}, true},
+		{"different keys", titleKey, false},
+		{"invalid key type", badType, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := NewFileStore(dir).EnsureSchema(context.Background(), test.schema)
+			if test.ok && err != nil {
+				t.Error(err)
+			}
+			if !test.ok && err == nil {
+				t.Error("error expected")
+			}
+		})
+	}
+}
+
+func TestFileStoreItems(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFileStore(t, testSchema)
+
+	for _, item := range []ArticleMetaInfo{{DOI: "10.1/1", Title: "First"}, {DOI: "10.1/2", Title: "Second"}, {DOI: "10.1/1", Title: "Updated"}} {
+		if err := store.Put(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	item, err := store.Get(ctx, ItemKey{Primary: "10.1/1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Title != "Updated" {
+		t.Errorf("title = %s, want Updated", item.Title)
+	}
+
+	items, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dois []string
+	for _, item := range items {
+		dois = append(dois, item.DOI)
+	}
+	sort.Strings(dois)
+	if !reflect.DeepEqual(dois, []string{"10.1/1", "10.1/2"}) {
+		t.Errorf("listed %v, want [10.1/1 10.1/2]", dois)
+	}
+
+	if err = store.Delete(ctx, ItemKey{Primary: "10.1/1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Get(ctx, ItemKey{Primary: "10.1/1"}); err != ErrItemNotFound {
+		t.Errorf("deleted item: error = %v, want ErrItemNotFound", err)
+	}
+	if err = store.Delete(ctx, ItemKey{Primary: "10.1/1"}); err != nil {
+		t.Errorf("deleting missing item: %v", err)
+	}
+}
+
+func TestFileStorePutKeys(t *testing.T) {
+	titleKey := TableSchema{Name: "Articles", PrimaryKey: "Title", PrimaryKeyType: "S"}
+	sortKey := TableSchema{Name: "Articles", PrimaryKey: "Publisher", PrimaryKeyType: "S", SortKey: "Volume", SortKeyType: "N"}
+
+	tests := []struct {
+		name     string
+		schema   TableSchema
+		items    []ArticleMetaInfo
+		conflict bool // the last item
+		failed   bool // the last item, not a conflict
+		stored   int
+	}{
+		{"DOI key", testSchema, []ArticleMetaInfo{{DOI: "10.1/1"}, {DOI: "10.1/2"}}, false, false, 2},
+		{"missing DOI", testSchema, []ArticleMetaInfo{{DOI: "10.1/1"}, {Title: "No DOI"}}, false, true, 1},
+		{"other article with the same key", titleKey, []ArticleMetaInfo{{DOI: "10.1/1", Title: "Title"}, {DOI: "10.1/2", Title: "Title"}}, true, false, 1},
+		{"the same article", titleKey, []ArticleMetaInfo{{DOI: "10.1/1", Title: "Title"}, {DOI: "10.1/1", Title: "Title"}}, false, false, 1},
+		{"records without DOI", titleKey, []ArticleMetaInfo{{Title: "A"}, {Title: "B"}}, false, false, 2},
+		{"sort key", sortKey, []ArticleMetaInfo{{Publisher: "Springer", Volume: 1}, {Publisher: "Springer", Volume: 2}}, false, false, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newTestFileStore(t, test.schema)
+
+			var err error
+			for _, item := range test.items {
+				err = store.Put(ctx, item)
+			}
+
+			var conflict *KeyConflictError
+			switch {
+			case test.conflict && !errors.As(err, &conflict):
+				t.Errorf("error = %v, want KeyConflictError", err)
+			case test.failed && err == nil:
+				t.Error("error expected")
+			case !test.conflict && !test.failed && err != nil:
+				t.Error(err)
+			}
+
+			if items, err := store.List(ctx); err != nil || len(items) != test.stored {
+				t.Errorf("%d items stored (%v), want %d", len(items), err, test.stored)
+			}
+		})
+	}
+}
+
+func TestFileStorePutCancelled(t *testing.T) {
+	store := newTestFileStore(t, testSchema)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := store.Put(ctx, ArticleMetaInfo{DOI: "10.1/1"}); err != context.Canceled {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+}
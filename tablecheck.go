@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Key attributes must be article fields of the same type, otherwise every item is rejected
+func (s TableSchema) Validate() error {
+	if s.PrimaryKeyType != "N" && s.PrimaryKeyType != "S" {
+		return fmt.Errorf("Incorrect primary key type '%s'. Should be 'N' (Number) or 'S' (String)", s.PrimaryKeyType)
+	}
+	if err := validateKey("Primary", s.PrimaryKey, s.PrimaryKeyType); err != nil {
+		return err
+	}
+
+	if s.SortKey != "" || s.SortKeyType != "" {
+		if s.SortKeyType != "N" && s.SortKeyType != "S" {
+			return fmt.Errorf("Incorrect sort key type '%s'. Should be 'N' (Number) or 'S' (String)", s.SortKeyType)
+		}
+		if err := validateKey("Sort", s.SortKey, s.SortKeyType); err != nil {
+			return err
+		}
+	}
+	return s.validateIndexes()
+}
+
+func validateKey(kind, name, keyType string) error {
+	// numbered from 0 by every run, so the same article would get another item on rerun
+	if name == "ID" {
+		return fmt.Errorf("%s key can't be ID, it is the order of insertion within a run and changes on every run", kind)
+	}
+
+	fieldType, err := articleAttributeType(name)
+	if err != nil {
+		return fmt.Errorf("%s key: %v", kind, err)
+	}
+	if fieldType != keyType {
+		return fmt.Errorf("%s key '%s' is %s, but article attribute is %s", kind, name, keyType, fieldType)
+	}
+	return nil
+}
+
+// hash and range key names of table or index
+func keyNames(keySchema []*dynamodb.KeySchemaElement) (hashKey, rangeKey string) {
+	for _, element := range keySchema {
+		if aws.StringValue(element.KeyType) == dynamodb.KeyTypeHash {
+			hashKey = aws.StringValue(element.AttributeName)
+		} else {
+			rangeKey = aws.StringValue(element.AttributeName)
+		}
+	}
+	return
+}
+
+// "DOI (S)", "none"
+func formatKey(name, keyType string) string {
+	if name == "" {
+		return "none"
+	}
+	return fmt.Sprintf("%s (%s)", name, keyType)
+}
+
+// Compares keys and indexes of existing table with the schema, all differences are reported at once
+func (db *DataBase) checkTable(ctx context.Context, schema TableSchema) error {
+	output, err := db.svc.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(schema.Name)})
+	if err != nil {
+		return err
+	}
+	table := output.Table
+
+	types := make(map[string]string)
+	for _, definition := range table.AttributeDefinitions {
+		types[aws.StringValue(definition.AttributeName)] = aws.StringValue(definition.AttributeType)
+	}
+
+	var problems []string
+	compare := func(kind, existing, requested, requestedType string) {
+		existingType := types[existing]
+		if existing != requested || (requested != "" && existingType != requestedType) {
+			problems = append(problems, fmt.Sprintf("%s key: table has %s, requested %s",
+				kind, formatKey(existing, existingType), formatKey(requested, requestedType)))
+		}
+	}
+
+	hashKey, rangeKey := keyNames(table.KeySchema)
+	compare("hash", hashKey, schema.PrimaryKey, schema.PrimaryKeyType)
+	compare("range", rangeKey, schema.SortKey, schema.SortKeyType)
+	problems = append(problems, schema.indexProblems(table)...)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Table '%s' doesn't match schema:\n  %s", schema.Name, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
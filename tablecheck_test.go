@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestTableSchemaValidate(t *testing.T) {
+	byPublisher := IndexSchema{Name: "ByPublisher", HashKey: "Publisher", RangeKey: "PublicationDate", Projection: "ALL"}
+
+	tests := []struct {
+		name   string
+		schema TableSchema
+		err    string // part of the error, "" - valid
+	}{
+		{"DOI key", testSchema, ""},
+		{"sort key", TableSchema{PrimaryKey: "Publisher", PrimaryKeyType: "S", SortKey: "Volume", SortKeyType: "N"}, ""},
+		{"index", TableSchema{PrimaryKey: "DOI", PrimaryKeyType: "S", Indexes: []IndexSchema{byPublisher}}, ""},
+		{"key type", TableSchema{PrimaryKey: "DOI", PrimaryKeyType: "B"}, "Incorrect primary key type"},
+		{"ID key", TableSchema{PrimaryKey: "ID", PrimaryKeyType: "N"}, "can't be ID"},
+		{"unknown attribute", TableSchema{PrimaryKey: "Doi", PrimaryKeyType: "S"}, "Primary key"},
+		{"attribute type", TableSchema{PrimaryKey: "Volume", PrimaryKeyType: "S"}, "'Volume' is S, but article attribute is N"},
+		{"sort key without type", TableSchema{PrimaryKey: "DOI", PrimaryKeyType: "S", SortKey: "Volume"}, "Incorrect sort key type"},
+		{"sort key type", TableSchema{PrimaryKey: "DOI", PrimaryKeyType: "S", SortKey: "Title", SortKeyType: "N"}, "Sort key 'Title'"},
+		{"duplicate index", TableSchema{PrimaryKey: "DOI", PrimaryKeyType: "S", Indexes: []IndexSchema{byPublisher, byPublisher}}, "Duplicate index name"},
+		{"index without hash key", TableSchema{PrimaryKey: "DOI", PrimaryKeyType: "S", Indexes: []IndexSchema{{Name: "ByYear", Projection: "ALL"}}}, "must have name and hash key"},
+		{"index projection", TableSchema{PrimaryKey: "DOI", PrimaryKeyType: "S", Indexes: []IndexSchema{{Name: "ByYear", HashKey: "PublicationDate", Projection: "INCLUDE"}}}, "requires attributes"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.schema.Validate()
+			switch {
+			case test.err == "" && err != nil:
+				t.Error(err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestCheckTable(t *testing.T) {
+	fake := newFakeDynamoDB()
+	fake.addTableDescription(&dynamodb.TableDescription{
+		TableName:   aws.String("Articles"),
+		TableStatus: aws.String(dynamodb.TableStatusActive),
+		KeySchema:   []*dynamodb.KeySchemaElement{{AttributeName: aws.String("DOI"), KeyType: aws.String(dynamodb.KeyTypeHash)}},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("DOI"), AttributeType: aws.String("S")},
+			{AttributeName: aws.String("Publisher"), AttributeType: aws.String("S")},
+		},
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndexDescription{{
+			IndexName: aws.String("ByPublisher"),
+			KeySchema: []*dynamodb.KeySchemaElement{{AttributeName: aws.String("Publisher"), KeyType: aws.String(dynamodb.KeyTypeHash)}},
+		}},
+	})
+	db := newFakeDataBase(t, fake, "")
+
+	tests := []struct {
+		name     string
+		schema   TableSchema
+		problems []string // all of them are reported
+	}{
+		{"matching", TableSchema{Name: "Articles", PrimaryKey: "DOI", PrimaryKeyType: "S"}, nil},
+		{"matching index", TableSchema{Name: "Articles", PrimaryKey: "DOI", PrimaryKeyType: "S", Indexes: []IndexSchema{{Name: "ByPublisher", HashKey: "Publisher"}}}, nil},
+		{"hash key", TableSchema{Name: "Articles", PrimaryKey: "Title", PrimaryKeyType: "S"}, []string{"hash key: table has DOI (S), requested Title (S)"}},
+		{"hash key type", TableSchema{Name: "Articles", PrimaryKey: "DOI", PrimaryKeyType: "N"}, []string{"hash key: table has DOI (S), requested DOI (N)"}},
+		{
+			"range key and indexes",
+			TableSchema{Name: "Articles", PrimaryKey: "DOI", PrimaryKeyType: "S", SortKey: "Volume", SortKeyType: "N", Indexes: []IndexSchema{
+				{Name: "ByPublisher", HashKey: "Publisher", RangeKey: "PublicationDate"},
+				{Name: "ByYear", HashKey: "PublicationDate"},
+			}},
+			[]string{
+				"range key: table has none, requested Volume (N)",
+				"index 'ByPublisher' has keys Publisher, expected Publisher+PublicationDate",
+				"index 'ByYear' is missing",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := db.checkTable(context.Background(), test.schema)
+			if test.problems == nil {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("error expected")
+			}
+			for _, problem := range test.problems {
+				if !strings.Contains(err.Error(), problem) {
+					t.Errorf("error %q doesn't report %q", err, problem)
+				}
+			}
+		})
+	}
+
+	if err := db.checkTable(context.Background(), TableSchema{Name: "Missing", PrimaryKey: "DOI", PrimaryKeyType: "S"}); err == nil {
+		t.Error("missing table: error expected")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Settings of tables created by CreateTableIfNotExists, existing tables are left as they are
+type TableOptions struct {
+	// PAY_PER_REQUEST billing, capacity units are not used
+	OnDemand      bool
+	ReadCapacity  int64
+	WriteCapacity int64
+
+	// nil - fixed capacity
+	AutoScaling *AutoScaling
+
+	// items expire TTLDays after they are written, 0 - attribute is only enabled for TTL
+	TTLAttribute string
+	TTLDays      int
+
+	PointInTimeRecovery bool
+	Tags                map[string]string
+}
+
+// target tracking of read and write capacity
+type AutoScaling struct {
+	MinCapacity       int64
+	MaxCapacity       int64
+	TargetUtilization float64 // percent
+}
+
+// min:max:target, example: 5:100:70
+func parseAutoScaling(value string) (*AutoScaling, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("Incorrect auto scaling '%s'. Should be min:max:target, example: 5:100:70", value)
+	}
+
+	minCapacity, err1 := strconv.ParseInt(parts[0], 10, 64)
+	maxCapacity, err2 := strconv.ParseInt(parts[1], 10, 64)
+	target, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, fmt.Errorf("Incorrect auto scaling '%s'. Should be min:max:target, example: 5:100:70", value)
+	}
+	return &AutoScaling{MinCapacity: minCapacity, MaxCapacity: maxCapacity, TargetUtilization: target}, nil
+}
+
+// key=value
+func parseTags(values []string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, value := range values {
+		i := strings.Index(value, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("Incorrect tag '%s'. Should be key=value", value)
+		}
+		tags[value[:i]] = value[i+1:]
+	}
+	return tags, nil
+}
+
+func (o TableOptions) Validate() error {
+	if o.OnDemand {
+		if o.AutoScaling != nil {
+			return errors.New("Auto scaling can't be used with on-demand billing")
+		}
+	} else if o.ReadCapacity < 1 || o.WriteCapacity < 1 {
+		return errors.New("Read and write capacity units must be positive")
+	}
+
+	if s := o.AutoScaling; s != nil {
+		if s.MinCapacity < 1 || s.MaxCapacity < s.MinCapacity {
+			return fmt.Errorf("Incorrect auto scaling capacity %d-%d", s.MinCapacity, s.MaxCapacity)
+		}
+		// allowed by Application Auto Scaling
+		if s.TargetUtilization < 20 || s.TargetUtilization > 90 {
+			return fmt.Errorf("Auto scaling target utilization must be between 20 and 90, got %g", s.TargetUtilization)
+		}
+	}
+
+	if o.TTLDays < 0 {
+		return errors.New("TTL days can't be negative")
+	}
+	if o.TTLDays > 0 && o.TTLAttribute == "" {
+		return errors.New("TTL days require TTL attribute")
+	}
+	return nil
+}
+
+// billing mode, capacity and tags of new table
+func (o TableOptions) apply(input *dynamodb.CreateTableInput) {
+	if o.OnDemand {
+		input.BillingMode = aws.String(dynamodb.BillingModePayPerRequest)
+	} else {
+		input.BillingMode = aws.String(dynamodb.BillingModeProvisioned)
+		input.ProvisionedThroughput = &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(o.ReadCapacity),
+			WriteCapacityUnits: aws.Int64(o.WriteCapacity),
+		}
+	}
+
+	for key, value := range o.Tags {
+		input.Tags = append(input.Tags, &dynamodb.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+}
+
+// settings that can be changed only after the table is active
+func (db *DataBase) configureTable(ctx context.Context, tablename string) error {
+	o := db.options
+
+	if o.TTLAttribute != "" {
+		fmt.Printf("Enabling TTL on '%s' attribute of '%s'\n", o.TTLAttribute, tablename)
+		_, err := db.svc.UpdateTimeToLiveWithContext(ctx, &dynamodb.UpdateTimeToLiveInput{
+			TableName: aws.String(tablename),
+			TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+				AttributeName: aws.String(o.TTLAttribute),
+				Enabled:       aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.PointInTimeRecovery {
+		fmt.Println("Enabling point-in-time recovery of", tablename)
+		_, err := db.svc.UpdateContinuousBackupsWithContext(ctx, &dynamodb.UpdateContinuousBackupsInput{
+			TableName: aws.String(tablename),
+			PointInTimeRecoverySpecification: &dynamodb.PointInTimeRecoverySpecification{
+				PointInTimeRecoveryEnabled: aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.AutoScaling != nil && !o.OnDemand {
+		return db.enableAutoScaling(ctx, tablename, o.AutoScaling)
+	}
+	return nil
+}
+
+func (db *DataBase) enableAutoScaling(ctx context.Context, tablename string, scaling *AutoScaling) error {
+	if db.scaling == nil {
+		return errors.New("Auto scaling client is not initialized")
+	}
+
+	fmt.Printf("Enabling auto scaling of '%s' (%d-%d units, %g%%)\n", tablename, scaling.MinCapacity, scaling.MaxCapacity, scaling.TargetUtilization)
+	dimensions := map[string]string{
+		applicationautoscaling.ScalableDimensionDynamodbTableReadCapacityUnits:  applicationautoscaling.MetricTypeDynamoDbreadCapacityUtilization,
+		applicationautoscaling.ScalableDimensionDynamodbTableWriteCapacityUnits: applicationautoscaling.MetricTypeDynamoDbwriteCapacityUtilization,
+	}
+	resourceID := "table/" + tablename
+
+	for dimension, metric := range dimensions {
+		_, err := db.scaling.RegisterScalableTargetWithContext(ctx, &applicationautoscaling.RegisterScalableTargetInput{
+			ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceDynamodb),
+			ResourceId:        aws.String(resourceID),
+			ScalableDimension: aws.String(dimension),
+			MinCapacity:       aws.Int64(scaling.MinCapacity),
+			MaxCapacity:       aws.Int64(scaling.MaxCapacity),
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = db.scaling.PutScalingPolicyWithContext(ctx, &applicationautoscaling.PutScalingPolicyInput{
+			PolicyName:        aws.String(tablename + "-" + metric),
+			PolicyType:        aws.String(applicationautoscaling.PolicyTypeTargetTrackingScaling),
+			ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceDynamodb),
+			ResourceId:        aws.String(resourceID),
+			ScalableDimension: aws.String(dimension),
+			TargetTrackingScalingPolicyConfiguration: &applicationautoscaling.TargetTrackingScalingPolicyConfiguration{
+				PredefinedMetricSpecification: &applicationautoscaling.PredefinedMetricSpecification{
+					PredefinedMetricType: aws.String(metric),
+				},
+				TargetValue: aws.Float64(scaling.TargetUtilization),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adds expiration time (epoch seconds) to written item
+func (db *DataBase) setExpiration(item map[string]*dynamodb.AttributeValue) {
+	o := db.options
+	if o.TTLAttribute == "" || o.TTLDays == 0 {
+		return
+	}
+
+	expires := time.Now().Add(time.Duration(o.TTLDays) * 24 * time.Hour).Unix()
+	item[o.TTLAttribute] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(expires, 10))}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// stops reading when limit of items is reached
+var errLimitReached = errors.New("Limit is reached")
+
+// Read of stored items. With Key items are queried by key of the table or Index,
+// otherwise the table (or index) is scanned
+type TableQuery struct {
+	Index string
+	Key   string // hash key value
+	Sort  string // range key value, optional
+
+	Years      string   // "2015" or "2015-2020", compared with PublicationDate
+	Publishers []string // any of them
+	Keywords   []string // all of them
+
+	Segments int // parallel scan segments
+	Limit    int // 0 - all items
+}
+
+// key attributes of table or index and their types
+type keySchema struct {
+	hashKey, rangeKey string
+	types             map[string]string
+}
+
+func (db *DataBase) describeKeys(ctx context.Context, tablename, index string) (keys keySchema, err error) {
+	output, err := db.svc.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tablename)})
+	if err != nil {
+		return keys, err
+	}
+	table := output.Table
+
+	keys.types = make(map[string]string)
+	for _, definition := range table.AttributeDefinitions {
+		keys.types[aws.StringValue(definition.AttributeName)] = aws.StringValue(definition.AttributeType)
+	}
+
+	if index == "" {
+		keys.hashKey, keys.rangeKey = keyNames(table.KeySchema)
+		return keys, nil
+	}
+
+	for _, gsi := range table.GlobalSecondaryIndexes {
+		if aws.StringValue(gsi.IndexName) == index {
+			keys.hashKey, keys.rangeKey = keyNames(gsi.KeySchema)
+			return keys, nil
+		}
+	}
+	return keys, fmt.Errorf("Table '%s' has no index '%s'", tablename, index)
+}
+
+// Uses existing table, key attributes are read from it
+func (db *DataBase) OpenTable(ctx context.Context, tablename string) error {
+	keys, err := db.describeKeys(ctx, tablename, "")
+	if err != nil {
+		return err
+	}
+
+	db.schema = TableSchema{
+		Name:           tablename,
+		PrimaryKey:     keys.hashKey,
+		PrimaryKeyType: keys.types[keys.hashKey],
+		SortKey:        keys.rangeKey,
+		SortKeyType:    keys.types[keys.rangeKey],
+	}
+	db.batch = newBatchWriter(db, maxBatchSize)
+	return nil
+}
+
+// numbers are sent as N
+func (keys keySchema) value(name, value string) expression.ValueBuilder {
+	if keys.types[name] == "N" {
+		return expression.Value(dynamodbattribute.Number(value))
+	}
+	return expression.Value(value)
+}
+
+// PublicationDate range of years, "2020-05-17" is between "2015" and "2020~"
+func yearsRange(value string) (from, to string, err error) {
+	years, err := parseYears(value)
+	if err != nil {
+		return "", "", err
+	}
+	return years[0], years[len(years)-1] + "~", nil
+}
+
+func joinConditions(conditions []expression.ConditionBuilder, join func(left, right expression.ConditionBuilder, other ...expression.ConditionBuilder) expression.ConditionBuilder) expression.ConditionBuilder {
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+	return join(conditions[0], conditions[1], conditions[2:]...)
+}
+
+// key condition (only for Query) and filter
+func (q TableQuery) build(keys keySchema) (*expression.Expression, error) {
+	var filters []expression.ConditionBuilder
+	filtered := make(map[string]bool)
+	var keyCondition *expression.KeyConditionBuilder
+
+	if q.Key != "" {
+		condition := expression.Key(keys.hashKey).Equal(keys.value(keys.hashKey, q.Key))
+		if q.Sort != "" {
+			if keys.rangeKey == "" {
+				return nil, errors.New("Sort key value is given, but table (index) has no range key")
+			}
+			condition = condition.And(expression.Key(keys.rangeKey).Equal(keys.value(keys.rangeKey, q.Sort)))
+		}
+		keyCondition = &condition
+	} else if q.Sort != "" {
+		return nil, errors.New("Sort key value requires hash key value")
+	}
+
+	if q.Years != "" {
+		from, to, err := yearsRange(q.Years)
+		if err != nil {
+			return nil, err
+		}
+
+		// key attributes can't be filtered in Query
+		if keyCondition != nil && keys.rangeKey == "PublicationDate" && q.Sort == "" {
+			condition := keyCondition.And(expression.Key("PublicationDate").Between(expression.Value(from), expression.Value(to)))
+			keyCondition = &condition
+		} else {
+			filters = append(filters, expression.Name("PublicationDate").Between(expression.Value(from), expression.Value(to)))
+			filtered["PublicationDate"] = true
+		}
+	}
+
+	if len(q.Publishers) > 0 {
+		var publishers []expression.ConditionBuilder
+		for _, publisher := range q.Publishers {
+			publishers = append(publishers, expression.Name("Publisher").Equal(expression.Value(publisher)))
+		}
+		filters = append(filters, joinConditions(publishers, expression.Or))
+		filtered["Publisher"] = true
+	}
+
+	// stored keywords are lowercased
+	for _, keyword := range q.Keywords {
+		filters = append(filters, expression.Name("Keywords").Contains(strings.ToLower(strings.TrimSpace(keyword))))
+		filtered["Keywords"] = true
+	}
+
+	if keyCondition != nil && (filtered[keys.hashKey] || filtered[keys.rangeKey]) {
+		return nil, errors.New("Key attributes of the table (index) can't be filtered in query, use -key and -sort instead")
+	}
+
+	if keyCondition == nil && len(filters) == 0 {
+		return nil, nil
+	}
+
+	builder := expression.NewBuilder()
+	if keyCondition != nil {
+		builder = builder.WithKeyCondition(*keyCondition)
+	}
+	if len(filters) > 0 {
+		builder = builder.WithFilter(joinConditions(filters, expression.And))
+	}
+
+	expr, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	return &expr, nil
+}
+
+// Reads items matching the query page by page, found is never called concurrently.
+// Returns number of found items
+func (db *DataBase) Find(ctx context.Context, tablename string, q TableQuery, found func(item ArticleMetaInfo) error) (int, error) {
+	keys, err := db.describeKeys(ctx, tablename, q.Index)
+	if err != nil {
+		return 0, err
+	}
+
+	expr, err := q.build(keys)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mutex sync.Mutex
+	var count int
+	var foundErr error
+
+	// false stops paging
+	page := func(items []map[string]*dynamodb.AttributeValue) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		for _, av := range items {
+			if foundErr != nil {
+				return false
+			}
+
+			var item ArticleMetaInfo
+			if err := dynamodbattribute.UnmarshalMap(av, &item); err != nil {
+				foundErr = err
+				break
+			}
+			if err := found(item); err != nil {
+				foundErr = err
+				break
+			}
+
+			count++
+			if q.Limit > 0 && count >= q.Limit {
+				foundErr = errLimitReached
+			}
+		}
+
+		// other segments stop too
+		if foundErr != nil {
+			cancel()
+			return false
+		}
+		return true
+	}
+
+	if q.Key != "" {
+		input := &dynamodb.QueryInput{
+			TableName:                 aws.String(tablename),
+			KeyConditionExpression:    expr.KeyCondition(),
+			FilterExpression:          expr.Filter(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		}
+		if q.Index != "" {
+			input.IndexName = aws.String(q.Index)
+		}
+
+		err = db.svc.QueryPagesWithContext(ctx, input, func(output *dynamodb.QueryOutput, last bool) bool {
+			return page(output.Items)
+		})
+	} else {
+		err = db.scanSegments(ctx, tablename, q, expr, page)
+	}
+
+	if foundErr != nil {
+		if foundErr == errLimitReached {
+			return count, nil
+		}
+		return count, foundErr
+	}
+	return count, err
+}
+
+// parallel Scan, every segment is read by own routine
+func (db *DataBase) scanSegments(ctx context.Context, tablename string, q TableQuery, expr *expression.Expression, page func([]map[string]*dynamodb.AttributeValue) bool) error {
+	segments := q.Segments
+	if segments < 1 {
+		segments = 1
+	}
+
+	var errs errorList
+	wg := &sync.WaitGroup{}
+	for segment := 0; segment < segments; segment++ {
+		input := &dynamodb.ScanInput{TableName: aws.String(tablename)}
+		if q.Index != "" {
+			input.IndexName = aws.String(q.Index)
+		}
+		if expr != nil {
+			input.FilterExpression = expr.Filter()
+			input.ExpressionAttributeNames = expr.Names()
+			input.ExpressionAttributeValues = expr.Values()
+		}
+		if segments > 1 {
+			input.Segment = aws.Int64(int64(segment))
+			input.TotalSegments = aws.Int64(int64(segments))
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs.add(db.svc.ScanPagesWithContext(ctx, input, func(output *dynamodb.ScanOutput, last bool) bool {
+				return page(output.Items)
+			}))
+		}()
+	}
+	wg.Wait()
+
+	if scanErrors := errs.Errors(); len(scanErrors) > 0 {
+		return scanErrors[0]
+	}
+	return nil
+}
+
+// Terminal table: DOI, date, publisher and title
+
+type tableWriter struct {
+	writer *tabwriter.Writer
+}
+
+func newTableWriter() *tableWriter {
+	w := &tableWriter{writer: tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)}
+	fmt.Fprintln(w.writer, "DOI\tDate\tPublisher\tTitle")
+	return w
+}
+
+func (w *tableWriter) Write(item ArticleMetaInfo) error {
+	_, err := fmt.Fprintf(w.writer, "%s\t%s\t%s\t%s\n", item.DOI, item.PublicationDate, item.Publisher, shorten(item.Title, 80))
+	return err
+}
+
+func (w *tableWriter) Close() error {
+	return w.writer.Flush()
+}
+
+func shorten(s string, length int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= length {
+		return s
+	}
+	return string([]rune(s)[:length-3]) + "..."
+}
+
+// flags selecting items, shared by query and delete commands. Returned function is called after Parse
+func addTableQueryFlags(flags *flag.FlagSet) func() TableQuery {
+	index := flags.String("index", "", "Global secondary index to query or scan. Example: -index=ByPublication")
+	key := flags.String("key", "", "Hash key value of the table (index), without it the table is scanned. Example: -key=\"10.1007/s11276-008-0131-4\"")
+	sort := flags.String("sort", "", "Range key value of the table (index), requires -key. Example: -sort=12")
+	year := flags.String("year", "", "Publication year or range of years. Example: -year=2015-2020")
+	var publishers, keywords listFlag
+	flags.Var(&publishers, "publisher", "Publisher of items, can be repeated (any of them). Example: -publisher=Springer")
+	flags.Var(&keywords, "keyword", "Keyword of items, can be repeated (all of them). Example: -keyword=decompilation")
+	segments := flags.Int("segments", 1, "Number of parallel scan segments. Example: -segments=8")
+	limit := flags.Int("limit", 0, "Max number of items, 0 - all. Example: -limit=100")
+
+	return func() TableQuery {
+		if *segments < 1 || *limit < 0 {
+			fmt.Fprintln(os.Stderr, "Invalid segments number or limit :", *segments, *limit)
+			os.Exit(1)
+		}
+
+		return TableQuery{
+			Index:      *index,
+			Key:        *key,
+			Sort:       *sort,
+			Years:      *year,
+			Publishers: publishers,
+			Keywords:   keywords,
+			Segments:   *segments,
+			Limit:      *limit,
+		}
+	}
+}
+
+const queryUsage = `  Reads stored metadata from DynamoDB table. With -key items are queried by key of the table (or -index),
+  otherwise the table is scanned. Example:
+  springerMetaInfo query -tablename="SampleTable" -index=ByPublisher -key="Springer" -year=2015-2020 -format=csv`
+
+func runQueryCommand(args []string) {
+	flags := newCommandFlags("query", queryUsage)
+
+	tablename := flags.String("tablename", "", "Table name to read from. Example: -tablename=\"Music\"")
+	tableQuery := addTableQueryFlags(flags)
+	format := flags.String("format", "table", "Output format. Possible formats - table/json/csv. Example: -format=json")
+	var outputs listFlag
+	flags.Var(&outputs, "output", "Also write items to file, can be repeated. Possible formats - jsonl/csv/parquet. Example: -output=csv:articles.csv")
+	credentials := addAWSFlags(flags)
+	flags.Parse(args)
+
+	requireFlag(flags, "tablename", *tablename)
+	query := tableQuery()
+
+	var printer RecordWriter
+	var err error
+	switch *format {
+	case "table":
+		printer = newTableWriter()
+	case "json":
+		printer, err = NewRecordWriter("jsonl:-", false)
+	case "csv":
+		printer, err = NewRecordWriter("csv:-", false)
+	default:
+		err = fmt.Errorf("Unknown format '%s'. Possible formats - table/json/csv", *format)
+	}
+	check(err)
+
+	exports, err := newExportWriters(outputs, false)
+	check(err)
+
+	database, err := credentials.database()
+	check(err)
+
+	count, err := database.Find(interruptContext(), *tablename, query, func(item ArticleMetaInfo) error {
+		if err := printer.Write(item); err != nil {
+			return err
+		}
+		return exports.Write(item)
+	})
+
+	// results are printed even if reading stopped
+	if closeErr := printer.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := exports.Close(); err == nil {
+		err = closeErr
+	}
+	check(err)
+
+	fmt.Fprintf(os.Stderr, "Found %d item(-s)\n", count)
+}
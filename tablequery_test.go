@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestTableQueryBuild(t *testing.T) {
+	table := keySchema{hashKey: "DOI", types: map[string]string{"DOI": "S"}}
+	byPublisher := keySchema{hashKey: "Publisher", rangeKey: "PublicationDate", types: map[string]string{"Publisher": "S", "PublicationDate": "S"}}
+	byVolume := keySchema{hashKey: "Volume", types: map[string]string{"Volume": "N"}}
+
+	tests := []struct {
+		name         string
+		query        TableQuery
+		keys         keySchema
+		keyCondition string // parts of key condition and filter, "" - none
+		filter       string
+		values       []string // S and N values
+	}{
+		{"scan of everything", TableQuery{}, table, "", "", nil},
+		{"key", TableQuery{Key: "10.1/1"}, table, "=", "", []string{"10.1/1"}},
+		{"number key", TableQuery{Key: "3"}, byVolume, "=", "", []string{"3"}},
+		{
+			"keywords are lowercased", TableQuery{Keywords: []string{"Decompilation", " Binary Code "}}, table,
+			"", "contains", []string{"binary code", "decompilation"},
+		},
+		{"any of publishers", TableQuery{Publishers: []string{"Springer", "Birkhäuser"}}, table, "", "OR", []string{"Birkhäuser", "Springer"}},
+		{"years are filtered", TableQuery{Years: "2015-2020"}, table, "", "BETWEEN", []string{"2015", "2020~"}},
+		{"years of range key", TableQuery{Key: "Springer", Years: "2018"}, byPublisher, "BETWEEN", "", []string{"2018", "2018~", "Springer"}},
+		{"years of table without range key are filtered", TableQuery{Key: "10.1/1", Years: "2018"}, table, "=", "BETWEEN", []string{"10.1/1", "2018", "2018~"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expr, err := test.query.build(test.keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.keyCondition == "" && test.filter == "" {
+				if expr != nil {
+					t.Errorf("expression = %+v, want nil", expr)
+				}
+				return
+			}
+
+			check := func(kind string, condition *string, want string) {
+				switch {
+				case want == "" && condition != nil:
+					t.Errorf("%s = %s, want none", kind, *condition)
+				case want != "" && (condition == nil || !strings.Contains(*condition, want)):
+					t.Errorf("%s = %v, want %s", kind, aws.StringValue(condition), want)
+				}
+			}
+			check("key condition", expr.KeyCondition(), test.keyCondition)
+			check("filter", expr.Filter(), test.filter)
+
+			var values []string
+			for _, value := range expr.Values() {
+				values = append(values, aws.StringValue(value.S)+aws.StringValue(value.N))
+			}
+			sort.Strings(values)
+			if strings.Join(values, "|") != strings.Join(test.values, "|") {
+				t.Errorf("values = %q, want %q", values, test.values)
+			}
+		})
+	}
+}
+
+func TestTableQueryBuildErrors(t *testing.T) {
+	table := keySchema{hashKey: "DOI", types: map[string]string{"DOI": "S"}}
+	byPublisher := keySchema{hashKey: "Publisher", rangeKey: "PublicationDate", types: map[string]string{"Publisher": "S", "PublicationDate": "S"}}
+
+	tests := []struct {
+		name  string
+		query TableQuery
+		keys  keySchema
+	}{
+		{"sort key without key", TableQuery{Sort: "2018"}, byPublisher},
+		{"sort key of table without range key", TableQuery{Key: "10.1/1", Sort: "2018"}, table},
+		{"filtered key attribute", TableQuery{Key: "Springer", Publishers: []string{"Springer"}}, byPublisher},
+		{"filtered range key", TableQuery{Key: "Springer", Sort: "2018-01-01", Years: "2018"}, byPublisher},
+		{"invalid years", TableQuery{Years: "recent"}, table},
+	}
+
+	for _, test := range tests {
+		if _, err := test.query.build(test.keys); err == nil {
+			t.Errorf("%s: error expected", test.name)
+		}
+	}
+}